@@ -0,0 +1,13 @@
+module github.com/bygui86/multi-profile/adapters/logrusadapter
+
+go 1.15
+
+require (
+	github.com/bygui86/multi-profile/v2 v2.2.0
+	github.com/sirupsen/logrus v1.8.1
+	github.com/stretchr/testify v1.6.1
+	golang.org/x/sys v0.10.0 // indirect
+)
+
+// in-repo builds use the local module, consumers get v2.2.0, the first release with the logging API
+replace github.com/bygui86/multi-profile/v2 => ../..
@@ -0,0 +1,57 @@
+/*
+	Package logrusadapter adapts a logrus logger to multi-profile, to be passed either as Config.Logger or as
+	Config.StructuredLogger. Fatal methods log at error level and never exit the application.
+*/
+package logrusadapter
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+// Logger adapts a logrus logger, it implements both profile.Logger and profile.StructuredLogger
+type Logger struct {
+	logger logrus.FieldLogger
+}
+
+// New returns a new Logger writing to the given logrus logger or entry
+func New(logger logrus.FieldLogger) *Logger {
+	return &Logger{logger: logger}
+}
+
+// Log logs the message with fields as logrus fields
+func (l *Logger) Log(level profile.Level, msg string, fields ...profile.Field) {
+	logrusFields := make(logrus.Fields, len(fields))
+	for _, field := range fields {
+		logrusFields[field.Key] = field.Value
+	}
+	entry := l.logger.WithFields(logrusFields)
+
+	switch level {
+	case profile.LevelDebug:
+		entry.Debug(msg)
+	case profile.LevelWarn:
+		entry.Warn(msg)
+	case profile.LevelError:
+		entry.Error(msg)
+	default:
+		entry.Info(msg)
+	}
+}
+
+func (l *Logger) Debug(args ...interface{}) { l.logger.Debug(args...) }
+func (l *Logger) Info(args ...interface{})  { l.logger.Info(args...) }
+func (l *Logger) Warn(args ...interface{})  { l.logger.Warn(args...) }
+func (l *Logger) Error(args ...interface{}) { l.logger.Error(args...) }
+
+// Fatal logs at error level, it never exits the application
+func (l *Logger) Fatal(args ...interface{}) { l.logger.Error(args...) }
+
+func (l *Logger) Debugf(template string, args ...interface{}) { l.logger.Debugf(template, args...) }
+func (l *Logger) Infof(template string, args ...interface{})  { l.logger.Infof(template, args...) }
+func (l *Logger) Warnf(template string, args ...interface{})  { l.logger.Warnf(template, args...) }
+func (l *Logger) Errorf(template string, args ...interface{}) { l.logger.Errorf(template, args...) }
+
+// Fatalf logs at error level, it never exits the application
+func (l *Logger) Fatalf(template string, args ...interface{}) { l.logger.Errorf(template, args...) }
@@ -0,0 +1,44 @@
+package logrusadapter_test
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+
+	"github.com/bygui86/multi-profile/adapters/logrusadapter"
+)
+
+var (
+	_ profile.Logger           = &logrusadapter.Logger{}
+	_ profile.StructuredLogger = &logrusadapter.Logger{}
+)
+
+func TestLog(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	adapter := logrusadapter.New(logger)
+
+	adapter.Log(profile.LevelWarn, "flush slow", profile.Field{Key: "mode", Value: "cpu"}, profile.Field{Key: "bytes", Value: 42})
+	adapter.Fatalf("flush %s", "failed")
+
+	entries := hook.AllEntries()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, logrus.WarnLevel, entries[0].Level)
+		assert.Equal(t, "flush slow", entries[0].Message)
+		assert.Equal(t, logrus.Fields{"mode": "cpu", "bytes": 42}, entries[0].Data)
+		assert.Equal(t, logrus.ErrorLevel, entries[1].Level)
+		assert.Equal(t, "flush failed", entries[1].Message)
+	}
+}
+
+func TestConfigLogger(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	profile.BlockProfile(&profile.Config{Path: t.TempDir(), Logger: logrusadapter.New(logger)}).Start().Stop()
+	if assert.NotEmpty(t, hook.AllEntries()) {
+		assert.Contains(t, hook.AllEntries()[0].Message, "Block profiling enabled")
+	}
+}
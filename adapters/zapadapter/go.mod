@@ -0,0 +1,12 @@
+module github.com/bygui86/multi-profile/adapters/zapadapter
+
+go 1.15
+
+require (
+	github.com/bygui86/multi-profile/v2 v2.2.0
+	github.com/stretchr/testify v1.6.1
+	go.uber.org/zap v1.16.0
+)
+
+// in-repo builds use the local module, consumers get v2.2.0, the first release with the logging API
+replace github.com/bygui86/multi-profile/v2 => ../..
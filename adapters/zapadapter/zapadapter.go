@@ -0,0 +1,57 @@
+/*
+	Package zapadapter adapts a zap logger to multi-profile, to be passed either as Config.Logger or as
+	Config.StructuredLogger. Fatal methods log at error level and never exit the application.
+*/
+package zapadapter
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+// Logger adapts a zap logger, it implements both profile.Logger and profile.StructuredLogger
+type Logger struct {
+	logger *zap.Logger
+	sugar  *zap.SugaredLogger
+}
+
+// New returns a new Logger writing to the given zap logger
+func New(logger *zap.Logger) *Logger {
+	return &Logger{logger: logger, sugar: logger.Sugar()}
+}
+
+// Log logs the message with fields as zap fields
+func (l *Logger) Log(level profile.Level, msg string, fields ...profile.Field) {
+	zapFields := make([]zap.Field, len(fields))
+	for i, field := range fields {
+		zapFields[i] = zap.Any(field.Key, field.Value)
+	}
+
+	switch level {
+	case profile.LevelDebug:
+		l.logger.Debug(msg, zapFields...)
+	case profile.LevelWarn:
+		l.logger.Warn(msg, zapFields...)
+	case profile.LevelError:
+		l.logger.Error(msg, zapFields...)
+	default:
+		l.logger.Info(msg, zapFields...)
+	}
+}
+
+func (l *Logger) Debug(args ...interface{}) { l.sugar.Debug(args...) }
+func (l *Logger) Info(args ...interface{})  { l.sugar.Info(args...) }
+func (l *Logger) Warn(args ...interface{})  { l.sugar.Warn(args...) }
+func (l *Logger) Error(args ...interface{}) { l.sugar.Error(args...) }
+
+// Fatal logs at error level, it never exits the application
+func (l *Logger) Fatal(args ...interface{}) { l.sugar.Error(args...) }
+
+func (l *Logger) Debugf(template string, args ...interface{}) { l.sugar.Debugf(template, args...) }
+func (l *Logger) Infof(template string, args ...interface{})  { l.sugar.Infof(template, args...) }
+func (l *Logger) Warnf(template string, args ...interface{})  { l.sugar.Warnf(template, args...) }
+func (l *Logger) Errorf(template string, args ...interface{}) { l.sugar.Errorf(template, args...) }
+
+// Fatalf logs at error level, it never exits the application
+func (l *Logger) Fatalf(template string, args ...interface{}) { l.sugar.Errorf(template, args...) }
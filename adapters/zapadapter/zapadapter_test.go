@@ -0,0 +1,42 @@
+package zapadapter_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/bygui86/multi-profile/v2"
+
+	"github.com/bygui86/multi-profile/adapters/zapadapter"
+)
+
+var (
+	_ profile.Logger           = &zapadapter.Logger{}
+	_ profile.StructuredLogger = &zapadapter.Logger{}
+)
+
+func TestLog(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zapadapter.New(zap.New(core))
+
+	logger.Log(profile.LevelWarn, "flush slow", profile.Field{Key: "mode", Value: "cpu"}, profile.Field{Key: "bytes", Value: 42})
+	logger.Fatalf("flush %s", "failed")
+
+	entries := logs.AllUntimed()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+		assert.Equal(t, "flush slow", entries[0].Message)
+		assert.Equal(t, map[string]interface{}{"mode": "cpu", "bytes": int64(42)}, entries[0].ContextMap())
+		assert.Equal(t, zapcore.ErrorLevel, entries[1].Level)
+		assert.Equal(t, "flush failed", entries[1].Message)
+	}
+}
+
+func TestConfigLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	profile.BlockProfile(&profile.Config{Path: t.TempDir(), Logger: zapadapter.New(zap.New(core))}).Start().Stop()
+	assert.NotEmpty(t, logs.FilterMessageSnippet("Block profiling enabled").All())
+}
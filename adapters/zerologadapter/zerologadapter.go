@@ -0,0 +1,72 @@
+/*
+	Package zerologadapter adapts a zerolog logger to multi-profile, to be passed either as Config.Logger or as
+	Config.StructuredLogger. Fatal methods log at error level and never exit the application.
+*/
+package zerologadapter
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+// Logger adapts a zerolog logger, it implements both profile.Logger and profile.StructuredLogger
+type Logger struct {
+	logger zerolog.Logger
+}
+
+// New returns a new Logger writing to the given zerolog logger
+func New(logger zerolog.Logger) *Logger {
+	return &Logger{logger: logger}
+}
+
+// Log logs the message with fields as zerolog fields
+func (l *Logger) Log(level profile.Level, msg string, fields ...profile.Field) {
+	event := l.event(level)
+	for _, field := range fields {
+		event = event.Interface(field.Key, field.Value)
+	}
+	event.Msg(msg)
+}
+
+// event returns a new event at the zerolog level matching the given level
+func (l *Logger) event(level profile.Level) *zerolog.Event {
+	switch level {
+	case profile.LevelDebug:
+		return l.logger.Debug()
+	case profile.LevelWarn:
+		return l.logger.Warn()
+	case profile.LevelError:
+		return l.logger.Error()
+	default:
+		return l.logger.Info()
+	}
+}
+
+func (l *Logger) Debug(args ...interface{}) { l.logger.Debug().Msg(fmt.Sprint(args...)) }
+func (l *Logger) Info(args ...interface{})  { l.logger.Info().Msg(fmt.Sprint(args...)) }
+func (l *Logger) Warn(args ...interface{})  { l.logger.Warn().Msg(fmt.Sprint(args...)) }
+func (l *Logger) Error(args ...interface{}) { l.logger.Error().Msg(fmt.Sprint(args...)) }
+
+// Fatal logs at error level, it never exits the application
+func (l *Logger) Fatal(args ...interface{}) { l.logger.Error().Msg(fmt.Sprint(args...)) }
+
+func (l *Logger) Debugf(template string, args ...interface{}) {
+	l.logger.Debug().Msgf(template, args...)
+}
+func (l *Logger) Infof(template string, args ...interface{}) {
+	l.logger.Info().Msgf(template, args...)
+}
+func (l *Logger) Warnf(template string, args ...interface{}) {
+	l.logger.Warn().Msgf(template, args...)
+}
+func (l *Logger) Errorf(template string, args ...interface{}) {
+	l.logger.Error().Msgf(template, args...)
+}
+
+// Fatalf logs at error level, it never exits the application
+func (l *Logger) Fatalf(template string, args ...interface{}) {
+	l.logger.Error().Msgf(template, args...)
+}
@@ -0,0 +1,54 @@
+package zerologadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+
+	"github.com/bygui86/multi-profile/adapters/zerologadapter"
+)
+
+var (
+	_ profile.Logger           = &zerologadapter.Logger{}
+	_ profile.StructuredLogger = &zerologadapter.Logger{}
+)
+
+// decodeLines decodes the JSON lines written by zerolog
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		decoded := make(map[string]interface{})
+		assert.NoError(t, json.Unmarshal([]byte(line), &decoded))
+		lines = append(lines, decoded)
+	}
+	return lines
+}
+
+func TestLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	adapter := zerologadapter.New(zerolog.New(buf))
+
+	adapter.Log(profile.LevelWarn, "flush slow", profile.Field{Key: "mode", Value: "cpu"}, profile.Field{Key: "bytes", Value: 42})
+	adapter.Fatalf("flush %s", "failed")
+
+	lines := decodeLines(t, buf)
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, map[string]interface{}{"level": "warn", "message": "flush slow", "mode": "cpu", "bytes": float64(42)}, lines[0])
+		assert.Equal(t, map[string]interface{}{"level": "error", "message": "flush failed"}, lines[1])
+	}
+}
+
+func TestConfigLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	profile.BlockProfile(&profile.Config{Path: t.TempDir(), Logger: zerologadapter.New(zerolog.New(buf))}).Start().Stop()
+	lines := decodeLines(t, buf)
+	if assert.NotEmpty(t, lines) {
+		assert.Contains(t, lines[0]["message"], "Block profiling enabled")
+	}
+}
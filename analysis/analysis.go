@@ -0,0 +1,95 @@
+// Package analysis provides a simple way to analyse pprof profiles written by multi-profile
+package analysis
+
+import (
+	"fmt"
+	"os"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+const (
+	// Well-known sample types of profiles written by multi-profile
+	SampleTypeSamples     = "samples"
+	SampleTypeCPU         = "cpu"
+	SampleTypeAllocSpace  = "alloc_space"
+	SampleTypeAllocCount  = "alloc_objects"
+	SampleTypeInuseSpace  = "inuse_space"
+	SampleTypeInuseCount  = "inuse_objects"
+	SampleTypeContentions = "contentions"
+	SampleTypeDelay       = "delay"
+	SampleTypeGoroutine   = "goroutine"
+	SampleTypeThread      = "threadcreate"
+)
+
+// Load reads and parses the pprof file at the given path
+func Load(path string) (*pprofile.Profile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	prof, err := pprofile.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("parse profile %s: %w", path, err)
+	}
+	return prof, nil
+}
+
+/*
+	SampleIndex returns the index of the given sample type in the profile.
+	If sampleType is blank, the profile default sample type is used, falling back to the last sample type
+	(same behaviour as "go tool pprof").
+*/
+func SampleIndex(prof *pprofile.Profile, sampleType string) (int, error) {
+	if len(prof.SampleType) == 0 {
+		return 0, fmt.Errorf("profile has no sample types")
+	}
+
+	if sampleType == "" {
+		sampleType = prof.DefaultSampleType
+	}
+	if sampleType == "" {
+		return len(prof.SampleType) - 1, nil
+	}
+
+	for idx, valueType := range prof.SampleType {
+		if valueType.Type == sampleType {
+			return idx, nil
+		}
+	}
+	return 0, fmt.Errorf("sample type %q not found in profile, available: %v", sampleType, sampleTypes(prof))
+}
+
+// sampleTypes returns the names of all sample types of the profile
+func sampleTypes(prof *pprofile.Profile) []string {
+	types := make([]string, 0, len(prof.SampleType))
+	for _, valueType := range prof.SampleType {
+		types = append(types, valueType.Type)
+	}
+	return types
+}
+
+// functionName returns the name of the function of the given line, falling back to the location address
+func functionName(loc *pprofile.Location, line pprofile.Line) string {
+	if line.Function != nil && line.Function.Name != "" {
+		return line.Function.Name
+	}
+	return fmt.Sprintf("0x%x", loc.Address)
+}
+
+// StackFunctions returns the function names of the sample stack, from leaf to root, expanding inlined frames
+func StackFunctions(sample *pprofile.Sample) []string {
+	functions := make([]string, 0, len(sample.Location))
+	for _, loc := range sample.Location {
+		if len(loc.Line) == 0 {
+			functions = append(functions, fmt.Sprintf("0x%x", loc.Address))
+			continue
+		}
+		for _, line := range loc.Line {
+			functions = append(functions, functionName(loc, line))
+		}
+	}
+	return functions
+}
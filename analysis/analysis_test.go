@@ -0,0 +1,148 @@
+package analysis_test
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	pprofile "github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2/analysis"
+)
+
+// buildProfile builds a CPU-like profile with one sample per stack, stacks are listed from leaf to root
+func buildProfile(stacks [][]string, values []int64) *pprofile.Profile {
+	prof := &pprofile.Profile{
+		SampleType: []*pprofile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "cpu", Unit: "nanoseconds"},
+		},
+		PeriodType: &pprofile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     1,
+	}
+
+	functions := make(map[string]*pprofile.Function)
+	locations := make(map[string]*pprofile.Location)
+	for idx, stack := range stacks {
+		sample := &pprofile.Sample{Value: []int64{1, values[idx]}}
+		for _, name := range stack {
+			loc, ok := locations[name]
+			if !ok {
+				fn := &pprofile.Function{ID: uint64(len(functions) + 1), Name: name}
+				functions[name] = fn
+				prof.Function = append(prof.Function, fn)
+				loc = &pprofile.Location{ID: uint64(len(locations) + 1), Line: []pprofile.Line{{Function: fn}}}
+				locations[name] = loc
+				prof.Location = append(prof.Location, loc)
+			}
+			sample.Location = append(sample.Location, loc)
+		}
+		prof.Sample = append(prof.Sample, sample)
+	}
+	return prof
+}
+
+func TestTop(t *testing.T) {
+	prof := buildProfile(
+		[][]string{{"main.leaf", "main.handler", "main.main"}, {"main.handler", "main.main"}, {"main.other", "main.main"}},
+		[]int64{60, 30, 10},
+	)
+
+	report, err := analysis.Top(prof, analysis.TopOptions{N: 2})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "cpu", report.SampleType)
+	assert.Equal(t, int64(100), report.Total)
+	assert.Equal(t, 4, report.TotalFunctions)
+	assert.Len(t, report.Entries, 2)
+	assert.Equal(t, "main.leaf", report.Entries[0].Function)
+	assert.Equal(t, int64(60), report.Entries[0].Flat)
+	assert.Equal(t, "main.handler", report.Entries[1].Function)
+	assert.Equal(t, int64(30), report.Entries[1].Flat)
+	assert.Equal(t, int64(90), report.Entries[1].Cum)
+	assert.InDelta(t, 90.0, report.Entries[1].SumPercent, 0.001)
+
+	cumReport, err := analysis.Top(prof, analysis.TopOptions{N: 1, Cumulative: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "main.main", cumReport.Entries[0].Function)
+	assert.Equal(t, int64(100), cumReport.Entries[0].Cum)
+
+	assert.True(t, strings.Contains(report.String(), "main.leaf"))
+}
+
+func TestTopUnknownSampleType(t *testing.T) {
+	prof := buildProfile([][]string{{"main.main"}}, []int64{1})
+
+	_, err := analysis.Top(prof, analysis.TopOptions{SampleType: analysis.SampleTypeDelay})
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	base := buildProfile(
+		[][]string{{"main.leaf", "main.main"}, {"main.other", "main.main"}},
+		[]int64{50, 50},
+	)
+	target := buildProfile(
+		[][]string{{"main.leaf", "main.main"}, {"main.other", "main.main"}, {"main.new", "main.main"}},
+		[]int64{80, 40, 5},
+	)
+
+	report, err := analysis.Diff(base, target, analysis.TopOptions{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(100), report.BaseTotal)
+	assert.Equal(t, int64(125), report.TargetTotal)
+	assert.Equal(t, int64(25), report.Delta)
+	assert.Equal(t, "main.leaf", report.Entries[0].Function)
+	assert.Equal(t, int64(30), report.Entries[0].FlatDelta)
+	assert.InDelta(t, 30.0, report.Entries[0].FlatDeltaPercent, 0.001)
+	assert.Equal(t, "main.other", report.Entries[1].Function)
+	assert.Equal(t, int64(-10), report.Entries[1].FlatDelta)
+	assert.Equal(t, "main.new", report.Entries[2].Function)
+	assert.Equal(t, int64(0), report.Entries[2].BaseFlat)
+
+	// base profile must not be modified
+	assert.Equal(t, int64(50), base.Sample[0].Value[1])
+}
+
+func TestMerge(t *testing.T) {
+	first := buildProfile([][]string{{"main.leaf", "main.main"}}, []int64{10})
+	second := buildProfile([][]string{{"main.leaf", "main.main"}, {"main.other", "main.main"}}, []int64{20, 5})
+
+	merged, err := analysis.Merge([]*pprofile.Profile{first, second}, []string{"first.pprof", "second.pprof"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"merged from first.pprof", "merged from second.pprof"}, merged.Comments)
+
+	report, err := analysis.Top(merged, analysis.TopOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(35), report.Total)
+	assert.Equal(t, "main.leaf", report.Entries[0].Function)
+	assert.Equal(t, int64(30), report.Entries[0].Flat)
+}
+
+func TestMergeIncompatible(t *testing.T) {
+	cpu := buildProfile([][]string{{"main.main"}}, []int64{10})
+	mem := buildProfile([][]string{{"main.main"}}, []int64{10})
+	mem.SampleType[1] = &pprofile.ValueType{Type: "alloc_space", Unit: "bytes"}
+
+	_, err := analysis.Merge([]*pprofile.Profile{cpu, mem}, []string{"cpu.pprof", "mem.pprof"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "mem.pprof can not be merged with cpu.pprof")
+}
+
+func TestSampleTypeConstants(t *testing.T) {
+	for lookupName, sampleType := range map[string]string{
+		"goroutine":    analysis.SampleTypeGoroutine,
+		"threadcreate": analysis.SampleTypeThread,
+	} {
+		var buf bytes.Buffer
+		assert.NoError(t, pprof.Lookup(lookupName).WriteTo(&buf, 0))
+		prof, err := pprofile.Parse(&buf)
+		if assert.NoError(t, err) {
+			_, err = analysis.SampleIndex(prof, sampleType)
+			assert.NoError(t, err, lookupName)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+const (
+	// baseLabel holds the sample label marking diff base samples, same as "go tool pprof -diff_base"
+	baseLabel = "pprof::base"
+)
+
+// DiffEntry holds flat and cumulative values of a single function in both profiles, with their deltas
+type DiffEntry struct {
+	Function         string  `json:"function"`
+	BaseFlat         int64   `json:"baseFlat"`
+	TargetFlat       int64   `json:"targetFlat"`
+	FlatDelta        int64   `json:"flatDelta"`
+	FlatDeltaPercent float64 `json:"flatDeltaPercent"`
+	BaseCum          int64   `json:"baseCum"`
+	TargetCum        int64   `json:"targetCum"`
+	CumDelta         int64   `json:"cumDelta"`
+	CumDeltaPercent  float64 `json:"cumDeltaPercent"`
+}
+
+/*
+	DiffReport holds per-function deltas between a base and a target profile, ranked by absolute delta.
+	Percentages are relative to the base total, same as "go tool pprof -diff_base".
+*/
+type DiffReport struct {
+	SampleType     string      `json:"sampleType"`
+	Unit           string      `json:"unit"`
+	BaseTotal      int64       `json:"baseTotal"`
+	TargetTotal    int64       `json:"targetTotal"`
+	Delta          int64       `json:"delta"`
+	TotalFunctions int         `json:"totalFunctions"`
+	Cumulative     bool        `json:"cumulative"`
+	Entries        []DiffEntry `json:"entries"`
+}
+
+/*
+	DiffProfile returns a profile holding target samples and base samples with negated values,
+	base samples are labeled "pprof::base" so the result can be inspected with "go tool pprof".
+	Input profiles are not modified.
+*/
+func DiffProfile(base, target *pprofile.Profile) (*pprofile.Profile, error) {
+	negatedBase := base.Copy()
+	negatedBase.Scale(-1)
+	negatedBase.SetLabel(baseLabel, []string{"true"})
+
+	diff, err := pprofile.Merge([]*pprofile.Profile{negatedBase, target.Copy()})
+	if err != nil {
+		return nil, fmt.Errorf("profiles can not be compared: %w", err)
+	}
+	return diff, nil
+}
+
+// Diff computes per-function deltas between base and target profiles, see DiffReport
+func Diff(base, target *pprofile.Profile, opts TopOptions) (*DiffReport, error) {
+	diff, err := DiffProfile(base, target)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := SampleIndex(diff, opts.SampleType)
+	if err != nil {
+		return nil, err
+	}
+
+	var baseSamples, targetSamples []*pprofile.Sample
+	for _, sample := range diff.Sample {
+		if sample.DiffBaseSample() {
+			baseSamples = append(baseSamples, sample)
+		} else {
+			targetSamples = append(targetSamples, sample)
+		}
+	}
+	// base samples values are negated, so base values and total are negative here
+	baseFlat, baseCum, baseTotal := functionValues(baseSamples, idx)
+	targetFlat, targetCum, targetTotal := functionValues(targetSamples, idx)
+
+	functions := make(map[string]bool, len(baseCum)+len(targetCum))
+	for fn := range baseCum {
+		functions[fn] = true
+	}
+	for fn := range targetCum {
+		functions[fn] = true
+	}
+
+	entries := make([]DiffEntry, 0, len(functions))
+	for fn := range functions {
+		entry := DiffEntry{
+			Function:   fn,
+			BaseFlat:   -baseFlat[fn],
+			TargetFlat: targetFlat[fn],
+			BaseCum:    -baseCum[fn],
+			TargetCum:  targetCum[fn],
+		}
+		entry.FlatDelta = entry.TargetFlat - entry.BaseFlat
+		entry.CumDelta = entry.TargetCum - entry.BaseCum
+		entry.FlatDeltaPercent = percent(entry.FlatDelta, -baseTotal)
+		entry.CumDeltaPercent = percent(entry.CumDelta, -baseTotal)
+		if entry.FlatDelta == 0 && entry.CumDelta == 0 {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if opts.Cumulative && abs(a.CumDelta) != abs(b.CumDelta) {
+			return abs(a.CumDelta) > abs(b.CumDelta)
+		}
+		if abs(a.FlatDelta) != abs(b.FlatDelta) {
+			return abs(a.FlatDelta) > abs(b.FlatDelta)
+		}
+		if abs(a.CumDelta) != abs(b.CumDelta) {
+			return abs(a.CumDelta) > abs(b.CumDelta)
+		}
+		return a.Function < b.Function
+	})
+
+	report := &DiffReport{
+		SampleType:     diff.SampleType[idx].Type,
+		Unit:           diff.SampleType[idx].Unit,
+		BaseTotal:      -baseTotal,
+		TargetTotal:    targetTotal,
+		Delta:          targetTotal + baseTotal,
+		TotalFunctions: len(entries),
+		Cumulative:     opts.Cumulative,
+	}
+	if opts.N > 0 && len(entries) > opts.N {
+		entries = entries[:opts.N]
+	}
+	report.Entries = entries
+	return report, nil
+}
+
+// DiffFiles loads the pprof files at the given paths and computes their per-function deltas, see Diff
+func DiffFiles(basePath, targetPath string, opts TopOptions) (*DiffReport, error) {
+	base, err := Load(basePath)
+	if err != nil {
+		return nil, err
+	}
+	target, err := Load(targetPath)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(base, target, opts)
+}
+
+// String returns the report as text table
+func (r *DiffReport) String() string {
+	builder := &strings.Builder{}
+	fmt.Fprintf(builder, "Showing top %d of %d changed functions, base %s, target %s, delta %s (%s)\n",
+		len(r.Entries), r.TotalFunctions, FormatValue(r.BaseTotal, r.Unit), FormatValue(r.TargetTotal, r.Unit),
+		formatDelta(r.Delta, r.Unit), r.SampleType)
+	fmt.Fprintf(builder, "%12s %12s %12s %8s %12s %8s  %s\n",
+		"base", "target", "flat delta", "flat%", "cum delta", "cum%", "function")
+	for _, entry := range r.Entries {
+		fmt.Fprintf(builder, "%12s %12s %12s %+7.2f%% %12s %+7.2f%%  %s\n",
+			FormatValue(entry.BaseFlat, r.Unit), FormatValue(entry.TargetFlat, r.Unit),
+			formatDelta(entry.FlatDelta, r.Unit), entry.FlatDeltaPercent,
+			formatDelta(entry.CumDelta, r.Unit), entry.CumDeltaPercent, entry.Function)
+	}
+	return builder.String()
+}
+
+// WriteTo writes the report as text table
+func (r *DiffReport) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, r.String())
+	return int64(n), err
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *DiffReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// formatDelta formats a delta value, always showing its sign
+func formatDelta(value int64, unit string) string {
+	if value > 0 {
+		return "+" + FormatValue(value, unit)
+	}
+	return FormatValue(value, unit)
+}
@@ -0,0 +1,33 @@
+package analysis
+
+import (
+	"fmt"
+	"time"
+)
+
+// FormatValue formats a sample value according to its unit (e.g. nanoseconds as duration, bytes as kB/MB/GB)
+func FormatValue(value int64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return time.Duration(value).String()
+	case "bytes":
+		return formatBytes(value)
+	default:
+		return fmt.Sprintf("%d", value)
+	}
+}
+
+// formatBytes formats a bytes value using the largest fitting unit
+func formatBytes(value int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	scaled := float64(value)
+	idx := 0
+	for idx < len(units)-1 && (scaled >= 1024 || scaled <= -1024) {
+		scaled /= 1024
+		idx++
+	}
+	if idx == 0 {
+		return fmt.Sprintf("%d%s", value, units[idx])
+	}
+	return fmt.Sprintf("%.2f%s", scaled, units[idx])
+}
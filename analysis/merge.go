@@ -0,0 +1,85 @@
+package analysis
+
+import (
+	"fmt"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+/*
+	Merge merges profiles of the same mode into a single aggregate profile.
+	Sample types of all profiles must match, sources (e.g. file names) are recorded in the merged profile comments.
+	Input profiles are not modified.
+*/
+func Merge(profiles []*pprofile.Profile, sources []string) (*pprofile.Profile, error) {
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no profile to merge")
+	}
+	if len(sources) != len(profiles) {
+		return nil, fmt.Errorf("expected %d sources, got %d", len(profiles), len(sources))
+	}
+
+	copies := make([]*pprofile.Profile, 0, len(profiles))
+	for idx, prof := range profiles {
+		err := checkCompatible(profiles[0], prof)
+		if err != nil {
+			return nil, fmt.Errorf("%s can not be merged with %s: %w", sources[idx], sources[0], err)
+		}
+		copies = append(copies, prof.Copy())
+	}
+
+	merged, err := pprofile.Merge(copies)
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		merged.Comments = append(merged.Comments, "merged from "+source)
+	}
+	return merged, nil
+}
+
+// MergeFiles loads the pprof files at the given paths and merges them, see Merge
+func MergeFiles(paths []string) (*pprofile.Profile, error) {
+	profiles := make([]*pprofile.Profile, 0, len(paths))
+	for _, path := range paths {
+		prof, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, prof)
+	}
+	return Merge(profiles, paths)
+}
+
+// checkCompatible returns an error if sample types or period type of the given profiles differ
+func checkCompatible(first, other *pprofile.Profile) error {
+	if len(first.SampleType) != len(other.SampleType) {
+		return fmt.Errorf("incompatible sample types %v and %v", sampleTypes(first), sampleTypes(other))
+	}
+	for idx := range first.SampleType {
+		if !equalValueType(first.SampleType[idx], other.SampleType[idx]) {
+			return fmt.Errorf("incompatible sample types %v and %v", sampleTypes(first), sampleTypes(other))
+		}
+	}
+	if !equalValueType(first.PeriodType, other.PeriodType) {
+		return fmt.Errorf("incompatible period types %s and %s",
+			valueTypeString(first.PeriodType), valueTypeString(other.PeriodType))
+	}
+	return nil
+}
+
+// equalValueType returns true if the given value types have same type and unit
+func equalValueType(a, b *pprofile.ValueType) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Type == b.Type && a.Unit == b.Unit
+}
+
+// valueTypeString returns the value type as "type/unit"
+func valueTypeString(valueType *pprofile.ValueType) string {
+	if valueType == nil {
+		return "none"
+	}
+	return valueType.Type + "/" + valueType.Unit
+}
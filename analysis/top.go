@@ -0,0 +1,169 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// TopEntry holds flat and cumulative values of a single function
+type TopEntry struct {
+	Function    string  `json:"function"`
+	Flat        int64   `json:"flat"`
+	FlatPercent float64 `json:"flatPercent"`
+	SumPercent  float64 `json:"sumPercent"`
+	Cum         int64   `json:"cum"`
+	CumPercent  float64 `json:"cumPercent"`
+}
+
+// TopReport holds the top-N functions of a profile for a sample type
+type TopReport struct {
+	SampleType     string     `json:"sampleType"`
+	Unit           string     `json:"unit"`
+	Total          int64      `json:"total"`
+	TotalFunctions int        `json:"totalFunctions"`
+	Cumulative     bool       `json:"cumulative"`
+	Entries        []TopEntry `json:"entries"`
+}
+
+// TopOptions holds configurations to build a TopReport
+type TopOptions struct {
+	/*
+		SampleType holds the sample type to rank functions by (e.g. cpu, alloc_space, inuse_space, contentions, delay)
+		If blank, the profile default sample type is used
+	*/
+	SampleType string
+
+	// N holds the maximum number of functions in the report, if not positive all functions are reported
+	N int
+
+	// Cumulative sorts functions by cumulative value instead of flat value
+	Cumulative bool
+}
+
+// Top builds the top-N flat/cumulative functions table of the given profile
+func Top(prof *pprofile.Profile, opts TopOptions) (*TopReport, error) {
+	idx, err := SampleIndex(prof, opts.SampleType)
+	if err != nil {
+		return nil, err
+	}
+
+	flat, cum, total := functionValues(prof.Sample, idx)
+
+	entries := make([]TopEntry, 0, len(cum))
+	for fn, cumValue := range cum {
+		entries = append(entries, TopEntry{
+			Function:    fn,
+			Flat:        flat[fn],
+			FlatPercent: percent(flat[fn], total),
+			Cum:         cumValue,
+			CumPercent:  percent(cumValue, total),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if opts.Cumulative && a.Cum != b.Cum {
+			return abs(a.Cum) > abs(b.Cum)
+		}
+		if a.Flat != b.Flat {
+			return abs(a.Flat) > abs(b.Flat)
+		}
+		if a.Cum != b.Cum {
+			return abs(a.Cum) > abs(b.Cum)
+		}
+		return a.Function < b.Function
+	})
+
+	report := &TopReport{
+		SampleType:     prof.SampleType[idx].Type,
+		Unit:           prof.SampleType[idx].Unit,
+		Total:          total,
+		TotalFunctions: len(entries),
+		Cumulative:     opts.Cumulative,
+	}
+	if opts.N > 0 && len(entries) > opts.N {
+		entries = entries[:opts.N]
+	}
+	var sum int64
+	for i := range entries {
+		sum += entries[i].Flat
+		entries[i].SumPercent = percent(sum, total)
+	}
+	report.Entries = entries
+	return report, nil
+}
+
+// TopFile loads the pprof file at the given path and builds its top-N functions table
+func TopFile(path string, opts TopOptions) (*TopReport, error) {
+	prof, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return Top(prof, opts)
+}
+
+// WriteTo writes the report as text table, in the same layout of "go tool pprof -top"
+func (r *TopReport) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, r.String())
+	return int64(n), err
+}
+
+// String returns the report as text table, in the same layout of "go tool pprof -top"
+func (r *TopReport) String() string {
+	builder := &strings.Builder{}
+	fmt.Fprintf(builder, "Showing top %d of %d functions, total %s (%s)\n",
+		len(r.Entries), r.TotalFunctions, FormatValue(r.Total, r.Unit), r.SampleType)
+	fmt.Fprintf(builder, "%12s %7s %7s %12s %7s  %s\n", "flat", "flat%", "sum%", "cum", "cum%", "function")
+	for _, entry := range r.Entries {
+		fmt.Fprintf(builder, "%12s %6.2f%% %6.2f%% %12s %6.2f%%  %s\n",
+			FormatValue(entry.Flat, r.Unit), entry.FlatPercent, entry.SumPercent,
+			FormatValue(entry.Cum, r.Unit), entry.CumPercent, entry.Function)
+	}
+	return builder.String()
+}
+
+// functionValues sums flat and cumulative values per function of the given samples, returning also the total value
+func functionValues(samples []*pprofile.Sample, idx int) (flat, cum map[string]int64, total int64) {
+	flat = make(map[string]int64)
+	cum = make(map[string]int64)
+	for _, sample := range samples {
+		value := sample.Value[idx]
+		if value == 0 {
+			continue
+		}
+		total += value
+
+		functions := StackFunctions(sample)
+		if len(functions) == 0 {
+			continue
+		}
+		flat[functions[0]] += value
+		seen := make(map[string]bool, len(functions))
+		for _, fn := range functions {
+			if !seen[fn] {
+				seen[fn] = true
+				cum[fn] += value
+			}
+		}
+	}
+	return flat, cum, total
+}
+
+// percent returns value as percentage of total
+func percent(value, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(value) * 100 / float64(total)
+}
+
+// abs returns the absolute value of v
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
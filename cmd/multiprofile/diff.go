@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bygui86/multi-profile/v2/analysis"
+)
+
+const diffUsage = "[flags] <base.pprof> <target.pprof>"
+
+var diffCommand = command{
+	description: "Compare two profiles and report per-function deltas (target - base)",
+	run:         runDiff,
+}
+
+// runDiff compares two profiles and writes a ranked report of per-function deltas
+func runDiff(args []string, stdout io.Writer) error {
+	flags := newFlagSet("diff", diffUsage)
+	sampleType := flags.String("sample_type", "", "sample type to compare (e.g. cpu, alloc_space, inuse_space, contentions, delay), profile default if blank")
+	topN := flags.Int("n", 20, "maximum number of functions to report, all if not positive")
+	cumulative := flags.Bool("cum", false, "rank functions by cumulative delta instead of flat delta")
+	format := flags.String("format", "text", "output format: text | json")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("expected 2 profiles, got %d", flags.NArg())
+	}
+
+	report, err := analysis.DiffFiles(flags.Arg(0), flags.Arg(1), analysis.TopOptions{
+		SampleType: *sampleType,
+		N:          *topN,
+		Cumulative: *cumulative,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "text":
+		_, err = report.WriteTo(stdout)
+	case "json":
+		err = report.WriteJSON(stdout)
+	default:
+		err = fmt.Errorf("unknown format %q, available: text | json", *format)
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bygui86/multi-profile/v2/analysis"
+	"github.com/bygui86/multi-profile/v2/flamegraph"
+)
+
+const flamegraphUsage = "[flags] <profile.pprof>"
+
+var flamegraphCommand = command{
+	description: "Render a profile as SVG flame graph or collapsed-stack (folded) text",
+	run:         runFlamegraph,
+}
+
+// runFlamegraph renders the given profile as flame graph, to the output file or stdout
+func runFlamegraph(args []string, stdout io.Writer) error {
+	flags := newFlagSet("flamegraph", flamegraphUsage)
+	sampleType := flags.String("sample_type", "", "sample type to render (e.g. cpu, alloc_space, inuse_space, goroutine), profile default if blank")
+	format := flags.String("format", "svg", "output format: svg | folded")
+	output := flags.String("o", "", "output file, stdout if blank")
+	title := flags.String("title", "", "title of the SVG flame graph")
+	width := flags.Int("width", flamegraph.DefaultWidth, "width in pixels of the SVG flame graph")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected 1 profile, got %d", flags.NArg())
+	}
+
+	prof, err := analysis.Load(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	w := stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch *format {
+	case "svg":
+		return flamegraph.SVG(w, prof, flamegraph.Options{SampleType: *sampleType, Title: *title, Width: *width})
+	case "folded":
+		return flamegraph.Folded(w, prof, *sampleType)
+	default:
+		return fmt.Errorf("unknown format %q, available: svg | folded", *format)
+	}
+}
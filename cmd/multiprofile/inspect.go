@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	pprofile "github.com/google/pprof/profile"
+
+	"github.com/bygui86/multi-profile/v2"
+	"github.com/bygui86/multi-profile/v2/analysis"
+)
+
+const inspectUsage = "[flags] <directory>..."
+
+var inspectCommand = command{
+	description: "List profiles in directories grouped by session, flagging empty or corrupt files",
+	run:         runInspect,
+}
+
+const (
+	traceMode   = "Trace"
+	flightMode  = "Trace flight recorder"
+	metricsMode = "Metrics"
+
+	// flightFileMarker is part of every flight recorder dump name, followed by the dump timestamp
+	flightFileMarker = "trace-flight-"
+)
+
+/*
+	fileModes holds the profiling mode of default multi-profile file names, used when the manifest is missing.
+	Names are matched as suffixes, as Config.FileNamePrefix may precede them.
+*/
+var fileModes = map[string]string{
+	"cpu.pprof":       "CPU",
+	"mem.pprof":       "Memory",
+	"mutex.pprof":     "Mutex",
+	"block.pprof":     "Block",
+	"trace.pprof":     traceMode,
+	"thread.pprof":    "Thread",
+	"goroutine.pprof": "Goroutine",
+	"metrics.jsonl":   metricsMode,
+	"metrics.csv":     metricsMode,
+}
+
+// capture describes a single profile file
+type capture struct {
+	path     string
+	mode     string
+	size     int64
+	duration time.Duration
+	manifest *profile.Manifest
+	prof     *pprofile.Profile
+	problems []string
+}
+
+// session groups captures written by the same process, or in the same directory when manifests are missing
+type session struct {
+	key       string
+	startTime time.Time
+	captures  []*capture
+}
+
+// runInspect lists profiles found in the given directories
+func runInspect(args []string, stdout io.Writer) error {
+	flags := newFlagSet("inspect", inspectUsage)
+	topN := flags.Int("n", 3, "number of top functions shown for each profile, none if not positive")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing directory to inspect")
+	}
+
+	var sessions []*session
+	for _, dir := range flags.Args() {
+		dirSessions, err := collectSessions(dir)
+		if err != nil {
+			return err
+		}
+		sessions = append(sessions, dirSessions...)
+	}
+	printSessions(stdout, sessions, *topN)
+	return nil
+}
+
+// collectSessions walks the given directory looking for profile files, grouping them by session
+func collectSessions(dir string) ([]*session, error) {
+	sessionsByKey := make(map[string]*session)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || (!strings.HasSuffix(info.Name(), ".pprof") && fileMode(info.Name()) == "") {
+			return nil
+		}
+
+		capt := inspectFile(path, info)
+		key := "directory " + filepath.Dir(path)
+		var startTime time.Time
+		if capt.manifest != nil {
+			key = fmt.Sprintf("host %s, pid %d", capt.manifest.Hostname, capt.manifest.PID)
+			startTime = capt.manifest.StartTime
+		}
+
+		sess, ok := sessionsByKey[key]
+		if !ok {
+			sess = &session{key: key, startTime: startTime}
+			sessionsByKey[key] = sess
+		}
+		if !startTime.IsZero() && (sess.startTime.IsZero() || startTime.Before(sess.startTime)) {
+			sess.startTime = startTime
+		}
+		sess.captures = append(sess.captures, capt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*session, 0, len(sessionsByKey))
+	for _, sess := range sessionsByKey {
+		sessions = append(sessions, sess)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].startTime.Equal(sessions[j].startTime) {
+			return sessions[i].startTime.Before(sessions[j].startTime)
+		}
+		return sessions[i].key < sessions[j].key
+	})
+	return sessions, nil
+}
+
+// fileMode returns the profiling mode of the given multi-profile file name, blank if unknown
+func fileMode(name string) string {
+	for fileName, mode := range fileModes {
+		if strings.HasSuffix(name, fileName) {
+			return mode
+		}
+	}
+	if strings.Contains(name, flightFileMarker) && strings.HasSuffix(name, ".pprof") {
+		return flightMode
+	}
+	return ""
+}
+
+// inspectFile reads the profile file and its manifest, if any, recording any problem found
+func inspectFile(path string, info os.FileInfo) *capture {
+	capt := &capture{
+		path: path,
+		mode: fileMode(info.Name()),
+		size: info.Size(),
+	}
+
+	manifestPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".manifest.json"
+	data, err := ioutil.ReadFile(manifestPath)
+	if err == nil {
+		manifest := &profile.Manifest{}
+		if json.Unmarshal(data, manifest) == nil {
+			capt.manifest = manifest
+			capt.mode = manifest.Mode
+			capt.duration = time.Duration(manifest.DurationSeconds * float64(time.Second))
+		} else {
+			capt.problems = append(capt.problems, "corrupt manifest "+manifestPath)
+		}
+	}
+
+	if capt.size == 0 {
+		capt.problems = append(capt.problems, "empty file")
+		return capt
+	}
+	if capt.mode == metricsMode {
+		// runtime metrics timeseries are not profiles, nothing more to check
+		return capt
+	}
+
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		capt.problems = append(capt.problems, "unreadable file: "+err.Error())
+		return capt
+	}
+	traceFile := capt.mode == traceMode || capt.mode == flightMode
+	if traceFile || isTrace(data) {
+		if !traceFile {
+			capt.mode = traceMode
+		}
+		if !isTrace(data) {
+			capt.problems = append(capt.problems, "corrupt file: missing execution trace header")
+		}
+		return capt
+	}
+
+	prof, err := pprofile.ParseData(data)
+	if err != nil {
+		capt.problems = append(capt.problems, "corrupt file: "+err.Error())
+		return capt
+	}
+	capt.prof = prof
+	if capt.duration == 0 {
+		capt.duration = time.Duration(prof.DurationNanos)
+	}
+	if capt.mode == "" {
+		capt.mode = "unknown"
+	}
+	return capt
+}
+
+// isTrace returns true if data starts with the execution trace header
+func isTrace(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("go 1."))
+}
+
+// printSessions prints the captures of every session, with their top functions
+func printSessions(w io.Writer, sessions []*session, topN int) {
+	if len(sessions) == 0 {
+		fmt.Fprintln(w, "No profile found")
+		return
+	}
+
+	for _, sess := range sessions {
+		fmt.Fprintf(w, "Session %s", sess.key)
+		if !sess.startTime.IsZero() {
+			fmt.Fprintf(w, ", started %s", sess.startTime.Format(time.RFC3339))
+		}
+		fmt.Fprintln(w)
+
+		sort.Slice(sess.captures, func(i, j int) bool {
+			return sess.captures[i].path < sess.captures[j].path
+		})
+		for _, capt := range sess.captures {
+			printCapture(w, capt, topN)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// printCapture prints mode, size, duration and top functions of a single capture
+func printCapture(w io.Writer, capt *capture, topN int) {
+	duration := "-"
+	if capt.duration > 0 {
+		duration = capt.duration.Round(time.Millisecond).String()
+	}
+	fmt.Fprintf(w, "  %s\n    mode %s, size %s, duration %s\n",
+		capt.path, capt.mode, analysis.FormatValue(capt.size, "bytes"), duration)
+
+	for _, problem := range capt.problems {
+		fmt.Fprintf(w, "    /!\\ %s\n", problem)
+	}
+	if capt.prof == nil || topN <= 0 {
+		return
+	}
+
+	report, err := analysis.Top(capt.prof, analysis.TopOptions{N: topN})
+	if err != nil {
+		fmt.Fprintf(w, "    could not analyse profile: %s\n", err.Error())
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(report.String(), "\n"), "\n") {
+		fmt.Fprintf(w, "    %s\n", line)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+func TestCollectSessions(t *testing.T) {
+	dir := t.TempDir()
+	profile.MemProfile(&profile.Config{Path: dir, Quiet: true, Manifest: true}).Start().Stop()
+	checkErr(t, ioutil.WriteFile(filepath.Join(dir, "goroutine.pprof"), nil, 0644))
+	checkErr(t, ioutil.WriteFile(filepath.Join(dir, "block.pprof"), []byte("garbage"), 0644))
+	checkErr(t, ioutil.WriteFile(filepath.Join(dir, "thread.pprof"), nil, 0644))
+	checkErr(t, ioutil.WriteFile(filepath.Join(dir, "thread.manifest.json"), []byte("garbage"), 0644))
+
+	sessions, err := collectSessions(dir)
+	checkErr(t, err)
+
+	problems, modes := capturesByName(sessions)
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, "", problems["mem.pprof"])
+	assert.Equal(t, "Memory", modes["mem.pprof"])
+	assert.Equal(t, "empty file", problems["goroutine.pprof"])
+	assert.Contains(t, problems["block.pprof"], "corrupt file")
+	assert.Contains(t, problems["thread.pprof"], "corrupt manifest")
+	assert.Contains(t, problems["thread.pprof"], "empty file")
+}
+
+func TestCollectSessionsPrefixedFiles(t *testing.T) {
+	dir := t.TempDir()
+	profile.MemProfile(&profile.Config{Path: dir, Quiet: true, FileNamePrefix: "api."}).Start().Stop()
+	metrics := profile.MetricsProfile(&profile.Config{
+		Path: dir, Quiet: true, FileNamePrefix: "api.", MetricsInterval: 10 * time.Millisecond,
+	}).Start()
+	time.Sleep(50 * time.Millisecond)
+	metrics.Stop()
+	flightDump := "api.trace-flight-20261018-101010.000.pprof"
+	checkErr(t, ioutil.WriteFile(filepath.Join(dir, flightDump), []byte("go 1.25 trace"), 0644))
+
+	sessions, err := collectSessions(dir)
+	checkErr(t, err)
+
+	problems, modes := capturesByName(sessions)
+	assert.Equal(t, "Memory", modes["api.mem.pprof"])
+	assert.Equal(t, "", problems["api.mem.pprof"])
+	assert.Equal(t, "Metrics", modes["api.metrics.jsonl"])
+	assert.Equal(t, "", problems["api.metrics.jsonl"])
+	assert.Equal(t, "Trace flight recorder", modes[flightDump])
+	assert.Equal(t, "", problems[flightDump])
+}
+
+// capturesByName returns problems and mode of all captures of the given sessions, by file name
+func capturesByName(sessions []*session) (map[string]string, map[string]string) {
+	problems := make(map[string]string)
+	modes := make(map[string]string)
+	for _, sess := range sessions {
+		for _, capt := range sess.captures {
+			problems[filepath.Base(capt.path)] = strings.Join(capt.problems, "; ")
+			modes[filepath.Base(capt.path)] = capt.mode
+		}
+	}
+	return problems, modes
+}
+
+// checkErr fails the test if err is not nil
+func checkErr(t *testing.T, err error) {
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,84 @@
+// Command multiprofile provides tools to work with profiles written by multi-profile
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// command defines a multiprofile subcommand
+type command struct {
+	// description holds a short description of the subcommand
+	description string
+
+	// run executes the subcommand with the given arguments, writing results to stdout
+	run func(args []string, stdout io.Writer) error
+}
+
+// commands holds all available subcommands by name
+var commands = map[string]command{
+	"diff":       diffCommand,
+	"flamegraph": flamegraphCommand,
+	"inspect":    inspectCommand,
+	"merge":      mergeCommand,
+	"run":        runCommand,
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "multiprofile: unknown command %q\n\n", name)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	err := cmd.run(os.Args[2:], os.Stdout)
+	if err == flag.ErrHelp {
+		os.Exit(2)
+	}
+	if exitErr, ok := err.(*exitError); ok {
+		os.Exit(exitErr.code)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "multiprofile %s: %s\n", name, err.Error())
+		os.Exit(1)
+	}
+}
+
+// usage prints the list of available subcommands
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: multiprofile <command> [flags] [arguments]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "\t%-12s %s\n", name, commands[name].description)
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Run 'multiprofile <command> -h' for command flags.")
+}
+
+// newFlagSet creates the flag set of a subcommand, printing its usage and flags on error
+func newFlagSet(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: multiprofile %s %s\n\nFlags:\n", name, usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
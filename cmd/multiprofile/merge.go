@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bygui86/multi-profile/v2/analysis"
+)
+
+const mergeUsage = "[flags] <profile.pprof>..."
+
+var mergeCommand = command{
+	description: "Merge profiles of the same mode into a single aggregate profile",
+	run:         runMerge,
+}
+
+// runMerge merges the given profiles and writes the result to the output file
+func runMerge(args []string, stdout io.Writer) error {
+	flags := newFlagSet("merge", mergeUsage)
+	output := flags.String("o", "merged.pprof", "output file of the merged profile")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing profiles to merge")
+	}
+
+	merged, err := analysis.MergeFiles(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	err = merged.Write(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Merged %d profiles into %s\n", flags.NArg(), *output)
+	return nil
+}
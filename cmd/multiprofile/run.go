@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+const runUsage = "[flags] -- <program> [arguments]"
+
+var runCommand = command{
+	description: "Run a program importing multi-profile with profiling enabled via environment variables",
+	run:         runRun,
+}
+
+// exitError reports the exit code of the program run by the "run" command
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("program exited with code %d", e.code)
+}
+
+// runRun launches the target program with profiling enabled, then prints a summary of the profiles written
+func runRun(args []string, stdout io.Writer) error {
+	flags := newFlagSet("run", runUsage)
+	output := flags.String("o", "./profiles", "output directory collecting all profiles")
+	modes := flags.String("modes", "", "comma separated list of profiling modes allowed to run (cpu,mem,mutex,block,trace,thread,goroutine,flight,metrics), all if blank")
+	manifest := flags.Bool("manifest", false, "write a JSON manifest next to each profile, program default if not set")
+	quiet := flags.Bool("quiet", false, "suppress multi-profile logs of the program")
+	topN := flags.Int("n", 5, "number of top functions in the summary of each profile, none if not positive")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing program to run")
+	}
+
+	outputDir, err := filepath.Abs(*output)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(outputDir, profile.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(flags.Arg(0), flags.Args()[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), profile.EnvPath+"="+outputDir)
+	if *modes != "" {
+		cmd.Env = append(cmd.Env, profile.EnvModes+"="+*modes)
+	}
+	// the environment overrides the Config, a default value would undo the Manifest or Quiet of the program
+	if isFlagSet(flags, "manifest") {
+		cmd.Env = append(cmd.Env, profile.EnvManifest+"="+strconv.FormatBool(*manifest))
+	}
+	if isFlagSet(flags, "quiet") {
+		cmd.Env = append(cmd.Env, profile.EnvQuiet+"="+strconv.FormatBool(*quiet))
+	}
+
+	runErr := runForwardingSignals(cmd)
+	var exitErr *exec.ExitError
+	if runErr != nil && !errors.As(runErr, &exitErr) {
+		return runErr
+	}
+
+	fmt.Fprintf(stdout, "\nProfiles collected in %s\n\n", outputDir)
+	sessions, err := collectSessions(outputDir)
+	if err != nil {
+		return err
+	}
+	printSessions(stdout, sessions, *topN)
+
+	if exitErr != nil {
+		return &exitError{code: exitCode(exitErr)}
+	}
+	return nil
+}
+
+// exitCode returns the exit code of the program, 128 plus the signal number if a signal killed it, as shells do
+func exitCode(err *exec.ExitError) int {
+	status, ok := err.Sys().(syscall.WaitStatus)
+	if ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return err.ExitCode()
+}
+
+// isFlagSet returns true if the flag with the given name was set on the command line
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// runForwardingSignals runs the command forwarding interruption signals to it, so it can stop and flush profiles
+func runForwardingSignals(cmd *exec.Cmd) error {
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGTERM, syscall.SIGINT, os.Interrupt)
+	defer signal.Stop(signalCh)
+
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- cmd.Wait()
+	}()
+
+	for {
+		select {
+		case sig := <-signalCh:
+			_ = cmd.Process.Signal(sig)
+		case err = <-doneCh:
+			return err
+		}
+	}
+}
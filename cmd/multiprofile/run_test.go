@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+// helperEnv holds the environment variable turning the test binary into the program run by TestRun
+const helperEnv = "MULTIPROFILE_TEST_HELPER"
+
+// killedExitCode makes TestRunHelperProcess kill itself instead of exiting
+const killedExitCode = -1
+
+/*
+	TestRunHelperProcess is the program run by TestRun: it writes a block profile and the values of EnvManifest and
+	EnvQuiet into the output directory, then exits with the code in helperEnv, or kills itself if killedExitCode
+*/
+func TestRunHelperProcess(t *testing.T) {
+	code := os.Getenv(helperEnv)
+	if code == "" {
+		return
+	}
+
+	profile.BlockProfile(&profile.Config{Quiet: true}).Start().Stop()
+	var env []string
+	for _, name := range []string{profile.EnvManifest, profile.EnvQuiet} {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			value = "unset"
+		}
+		env = append(env, name+"="+value)
+	}
+	_ = ioutil.WriteFile(filepath.Join(os.Getenv(profile.EnvPath), "env.txt"), []byte(strings.Join(env, "\n")), 0644)
+
+	exitCode, _ := strconv.Atoi(code)
+	if exitCode == killedExitCode {
+		process, _ := os.FindProcess(os.Getpid())
+		_ = process.Kill()
+		select {}
+	}
+	os.Exit(exitCode)
+}
+
+// runHelper runs the "run" command on the test binary acting as TestRunHelperProcess, into the given directory
+func runHelper(t *testing.T, dir string, exitCode int, flags ...string) (string, string, error) {
+	checkErr(t, os.Setenv(helperEnv, strconv.Itoa(exitCode)))
+	defer os.Unsetenv(helperEnv)
+
+	var stdout bytes.Buffer
+	args := append([]string{"-o", dir}, flags...)
+	args = append(args, "--", os.Args[0], "-test.run=TestRunHelperProcess")
+	err := runRun(args, &stdout)
+
+	env, readErr := ioutil.ReadFile(filepath.Join(dir, "env.txt"))
+	checkErr(t, readErr)
+	return stdout.String(), string(env), err
+}
+
+func TestRun(t *testing.T) {
+	stdout, env, err := runHelper(t, t.TempDir(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, profile.EnvManifest+"=unset\n"+profile.EnvQuiet+"=unset", env)
+	assert.Contains(t, stdout, "Profiles collected in")
+	assert.Contains(t, stdout, "block.pprof")
+
+	_, env, err = runHelper(t, t.TempDir(), 0, "-quiet=false", "-manifest=false")
+	assert.NoError(t, err)
+	assert.Equal(t, profile.EnvManifest+"=false\n"+profile.EnvQuiet+"=false", env)
+
+	_, env, err = runHelper(t, t.TempDir(), 3, "-quiet", "-manifest")
+	assert.Equal(t, profile.EnvManifest+"=true\n"+profile.EnvQuiet+"=true", env)
+	if assert.IsType(t, &exitError{}, err) {
+		assert.Equal(t, 3, err.(*exitError).code)
+	}
+}
+
+func TestRunKilled(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals not supported on windows")
+	}
+
+	_, _, err := runHelper(t, t.TempDir(), killedExitCode)
+	if assert.IsType(t, &exitError{}, err) {
+		assert.Equal(t, 128+int(syscall.SIGKILL), err.(*exitError).code)
+	}
+}
+
+func TestRunOutputDirMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes not supported on windows")
+	}
+
+	dir := filepath.Join(t.TempDir(), "profiles")
+	_, _, err := runHelper(t, dir, 0)
+	assert.NoError(t, err)
+	info, err := os.Stat(dir)
+	if assert.NoError(t, err) {
+		assert.Equal(t, profile.DefaultDirMode, info.Mode().Perm())
+	}
+}
@@ -0,0 +1,92 @@
+package profile
+
+import (
+	"bytes"
+	"runtime"
+	"runtime/pprof"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// supportsDelta returns true if the profile can be written in delta mode
+func (p *Profile) supportsDelta() bool {
+	switch p.mode {
+	case mutexMode, blockMode:
+		return true
+	case memMode:
+		return p.memProfileType == MemProfileAllocs
+	default:
+		return false
+	}
+}
+
+// startDelta takes the snapshot of the profile used as base in delta mode
+func (p *Profile) startDelta() {
+	if !p.delta {
+		return
+	}
+	if !p.supportsDelta() {
+		p.logf(LevelWarn, "%s profiling (%s) does not support delta mode, the cumulative profile will be written",
+			string(p.mode), p.lookupName)
+		return
+	}
+
+	var err error
+	p.deltaBase, err = p.snapshotData(pprof.Lookup(p.lookupName))
+	if err != nil {
+		p.logf(LevelError, "%s profiling delta snapshot failed, the cumulative profile will be written: %s",
+			string(p.mode), err.Error())
+		return
+	}
+
+	p.logf(LevelInfo, "%s profiling delta mode enabled", string(p.mode))
+}
+
+// writeDelta writes to file the difference between the given profile and the snapshot taken at Start
+func (p *Profile) writeDelta(lookupProfile *pprof.Profile) error {
+	current, err := p.snapshot(lookupProfile)
+	if err != nil {
+		return err
+	}
+
+	base, err := pprofile.ParseData(p.deltaBase)
+	p.deltaBase = nil
+	if err != nil {
+		return err
+	}
+	base.Scale(-1)
+	delta, err := pprofile.Merge([]*pprofile.Profile{base, current})
+	if err != nil {
+		return err
+	}
+	delta.TimeNanos = current.TimeNanos
+	delta.DurationNanos = current.TimeNanos - base.TimeNanos
+
+	return delta.Write(p.file)
+}
+
+// snapshot writes the given profile into memory and parses it
+func (p *Profile) snapshot(lookupProfile *pprof.Profile) (*pprofile.Profile, error) {
+	data, err := p.snapshotData(lookupProfile)
+	if err != nil {
+		return nil, err
+	}
+	return pprofile.ParseData(data)
+}
+
+/*
+	snapshotData writes the given profile into memory.
+	Memory profile reports data as of the most recently completed garbage collection, so one is run before.
+*/
+func (p *Profile) snapshotData(lookupProfile *pprof.Profile) ([]byte, error) {
+	if p.mode == memMode {
+		runtime.GC()
+	}
+
+	buf := &bytes.Buffer{}
+	err := lookupProfile.WriteTo(buf, 0)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
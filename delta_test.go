@@ -0,0 +1,55 @@
+package profile_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+	"github.com/bygui86/multi-profile/v2/analysis"
+)
+
+var allocSink [][]byte
+
+//go:noinline
+func allocBeforeSession() {
+	for i := 0; i < 1000; i++ {
+		allocSink = append(allocSink, make([]byte, 1024))
+	}
+}
+
+//go:noinline
+func allocDuringSession() {
+	for i := 0; i < 1000; i++ {
+		allocSink = append(allocSink, make([]byte, 1024))
+	}
+}
+
+func TestDeltaAllocsProfile(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &profile.Config{
+		Path:           dir,
+		Quiet:          true,
+		MemProfileType: profile.MemProfileAllocs,
+		MemProfileRate: 1,
+		Delta:          true,
+	}
+
+	allocBeforeSession()
+	prof := profile.MemProfile(cfg).Start()
+	allocDuringSession()
+	prof.Stop()
+	allocSink = nil
+
+	report, err := analysis.TopFile(filepath.Join(dir, "mem.pprof"),
+		analysis.TopOptions{SampleType: analysis.SampleTypeAllocSpace})
+	checkErr(t, err)
+
+	functions := make(map[string]int64)
+	for _, entry := range report.Entries {
+		functions[entry.Function] = entry.Flat
+	}
+	assert.Contains(t, functions, "github.com/bygui86/multi-profile/v2_test.allocDuringSession")
+	assert.NotContains(t, functions, "github.com/bygui86/multi-profile/v2_test.allocBeforeSession")
+}
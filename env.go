@@ -0,0 +1,88 @@
+package profile
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+	Environment variables overriding the Config of every profile created by the application,
+	so a binary importing multi-profile can be profiled without editing code (see cmd/multiprofile "run" command).
+*/
+const (
+	// EnvPath overrides Path (and disables UseTempPath) of every profile
+	EnvPath = "MULTIPROFILE_PATH"
+
+	/*
+		EnvModes holds a comma separated list of profiling modes allowed to run, other profiles Start and Stop are no-op
+		Available values:   cpu | mem | mutex | block | trace | thread | goroutine | flight | metrics
+	*/
+	EnvModes = "MULTIPROFILE_MODES"
+
+	// EnvManifest overrides Manifest of every profile, boolean value (e.g. true, false, 1, 0)
+	EnvManifest = "MULTIPROFILE_MANIFEST"
+
+	// EnvQuiet overrides Quiet of every profile, boolean value (e.g. true, false, 1, 0)
+	EnvQuiet = "MULTIPROFILE_QUIET"
+
+	/*
+		EnvLogLevel overrides LogLevel of every profile, invalid values are ignored
+		Available values:   debug | info | warn | error
+	*/
+	EnvLogLevel = "MULTIPROFILE_LOG_LEVEL"
+)
+
+// modeEnvNames holds the name of each profiling mode used in EnvModes
+var modeEnvNames = map[profileMode]string{
+	cpuMode:       "cpu",
+	memMode:       "mem",
+	mutexMode:     "mutex",
+	blockMode:     "block",
+	traceMode:     "trace",
+	threadMode:    "thread",
+	goroutineMode: "goroutine",
+	flightMode:    "flight",
+	metricsMode:   "metrics",
+}
+
+// applyEnv overrides profile configurations with values from environment variables, if set
+func (p *Profile) applyEnv() {
+	path, ok := os.LookupEnv(EnvPath)
+	if ok && path != "" {
+		p.path = path
+		p.useTempPath = false
+	}
+
+	modes, ok := os.LookupEnv(EnvModes)
+	if ok && modes != "" {
+		p.disabled = true
+		for _, mode := range strings.Split(modes, ",") {
+			if strings.EqualFold(strings.TrimSpace(mode), modeEnvNames[p.mode]) {
+				p.disabled = false
+				break
+			}
+		}
+	}
+
+	p.manifest = envBool(EnvManifest, p.manifest)
+	p.quiet = envBool(EnvQuiet, p.quiet)
+
+	level := Level(strings.ToLower(strings.TrimSpace(os.Getenv(EnvLogLevel))))
+	if _, ok := levelRanks[level]; ok {
+		p.logLevel = level
+	}
+}
+
+// envBool returns the boolean value of the given environment variable, or fallback if not set or not valid
+func envBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,31 @@
+package profile_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+func TestEnvOverrides(t *testing.T) {
+	dir := t.TempDir()
+	checkErr(t, os.Setenv(profile.EnvPath, dir))
+	checkErr(t, os.Setenv(profile.EnvModes, "mem,goroutine"))
+	checkErr(t, os.Setenv(profile.EnvQuiet, "true"))
+	defer os.Unsetenv(profile.EnvPath)
+	defer os.Unsetenv(profile.EnvModes)
+	defer os.Unsetenv(profile.EnvQuiet)
+
+	profile.CPUProfile(&profile.Config{Path: "./cpu-env-test"}).Start().Stop()
+	profile.MemProfile(&profile.Config{UseTempPath: true}).Start().Stop()
+
+	_, err := os.Stat(filepath.Join(dir, "cpu.pprof"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat("./cpu-env-test")
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "mem.pprof"))
+	assert.NoError(t, err)
+}
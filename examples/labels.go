@@ -0,0 +1,43 @@
+package examples
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+// Example to attribute CPU samples to a code region
+func Region() {
+	defer profile.CPUProfile(&profile.Config{}).Start().Stop()
+
+	profile.Region(context.Background(), "handler", "/users", func(ctx context.Context) {
+		// ...
+	})
+}
+
+// Example to label each HTTP request by route and method
+func LabelHandler() {
+	defer profile.CPUProfile(&profile.Config{}).Start().Stop()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {})
+
+	// group all "/users/<id>" requests under the same route
+	routeFn := func(r *http.Request) string {
+		if strings.HasPrefix(r.URL.Path, "/users/") {
+			return "/users/{id}"
+		}
+		return r.URL.Path
+	}
+	_ = http.ListenAndServe(":8080", profile.LabelHandler(mux, routeFn))
+}
+
+// Example to expose profiler self-metrics to Prometheus
+func SelfMetrics() {
+	defer profile.CPUProfile(&profile.Config{}).Start().Stop()
+
+	http.Handle("/metrics/profiler", profile.SelfMetricsHandler())
+	_ = http.ListenAndServe(":8080", nil)
+}
@@ -5,6 +5,9 @@ import (
 	"os"
 
 	"github.com/bygui86/multi-profile/v2"
+	"github.com/bygui86/multi-profile/v2/ingest"
+	"github.com/bygui86/multi-profile/v2/s3sink"
+	"github.com/bygui86/multi-profile/v2/webhook"
 )
 
 // Example to write profile to default path (same as application)
@@ -47,6 +50,122 @@ func Quiet() {
 	defer prof.Stop()
 }
 
+// Example to write a JSON manifest with session details next to the profile file
+func Manifest() {
+	cfg := &profile.Config{
+		Manifest: true,
+		Labels: map[string]string{
+			"service":     "my-service",
+			"environment": "production",
+		},
+	}
+	prof := profile.CPUProfile(cfg)
+	prof.Start()
+	defer prof.Stop()
+}
+
+// Example to embed labels and comments into the profile file
+func EmbedMetadata() {
+	cfg := &profile.Config{
+		EmbedMetadata: true,
+		Labels: map[string]string{
+			"service":     "my-service",
+			"version":     "v1.2.3",
+			"environment": "production",
+			"instance":    "my-service-0",
+		},
+		Comments: []string{"profiled during load test"},
+	}
+	prof := profile.MemProfile(cfg)
+	prof.Start()
+	defer prof.Stop()
+}
+
+// Example to log the top 10 functions by allocated bytes after profile Stop
+func TopSummary() {
+	cfg := &profile.Config{
+		TopN:          10,
+		TopSampleType: "alloc_space",
+	}
+	prof := profile.MemProfile(cfg)
+	prof.Start()
+	defer prof.Stop()
+}
+
+// Example to write only allocations made between Start and Stop
+func DeltaAllocs() {
+	cfg := &profile.Config{
+		MemProfileType: profile.MemProfileAllocs,
+		Delta:          true,
+	}
+	prof := profile.MemProfile(cfg)
+	prof.Start()
+	defer prof.Stop()
+}
+
+// Example to upload profiles to an S3-compatible object store
+func UploadToS3() {
+	sink, err := s3sink.New(&s3sink.Config{
+		Endpoint:        "https://s3.eu-west-1.amazonaws.com",
+		Region:          "eu-west-1",
+		Bucket:          "profiles",
+		Prefix:          "my-service",
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		MaxRetries:      s3sink.DefaultMaxRetries,
+		DeleteLocal:     true,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	cfg := &profile.Config{
+		Manifest: true,
+		Sinks:    []profile.Sink{sink},
+	}
+	prof := profile.CPUProfile(cfg)
+	prof.Start()
+	defer prof.Stop()
+}
+
+// Example to push profiles to a continuous-profiling server
+func PushToIngestServer() {
+	exporter, err := ingest.New(&ingest.Config{
+		ServerURL:       "http://pyroscope:4040",
+		ApplicationName: "my-service",
+		Labels:          map[string]string{"env": "prod"},
+	})
+	if err != nil {
+		panic(err)
+	}
+	defer exporter.Close()
+
+	cfg := &profile.Config{
+		Sinks: []profile.Sink{exporter},
+	}
+	prof := profile.CPUProfile(cfg)
+	prof.Start()
+	defer prof.Stop()
+}
+
+// Example to be notified through a webhook when a profile completes
+func NotifyWebhook() {
+	notifier, err := webhook.New(&webhook.Config{
+		URLs:    []string{"https://hooks.example.com/profiles"},
+		Headers: map[string]string{"Authorization": "Bearer " + os.Getenv("WEBHOOK_TOKEN")},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	cfg := &profile.Config{
+		Notifiers: []profile.Notifier{notifier},
+	}
+	prof := profile.CPUProfile(cfg)
+	prof.Start()
+	defer prof.Stop()
+}
+
 // Example with a custom closer function
 func CustomCloser() {
 	cfg := &profile.Config{
@@ -58,3 +177,21 @@ func CustomCloser() {
 	prof.Start()
 	defer prof.Stop()
 }
+
+// Example with result and pre-start hooks
+func ResultHooks() {
+	cfg := &profile.Config{
+		PreStartHook: func(mode, filePath string) {
+			fmt.Printf("Starting %s profiling, writing file %s\n", mode, filePath)
+		},
+		ResultHook: func(result profile.Result) {
+			if result.Err != nil {
+				fmt.Printf("%s profiling failed: %s\n", result.Mode, result.Err)
+				return
+			}
+			fmt.Printf("%s profiling wrote %d bytes to %s in %s\n", result.Mode, result.Size, result.Path, result.Duration)
+		},
+	}
+	defer profile.CPUProfile(cfg).Start().Stop()
+	defer profile.MemProfile(cfg).Start().Stop()
+}
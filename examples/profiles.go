@@ -1,6 +1,8 @@
 package examples
 
 import (
+	"time"
+
 	"github.com/bygui86/multi-profile/v2"
 )
 
@@ -79,6 +81,46 @@ func TraceProfile() {
 	defer prof.Stop()
 }
 
+// Record runtime metrics every 500 milliseconds as CSV timeseries
+func MetricsProfile() {
+	cfg := &profile.Config{
+		MetricsInterval: 500 * time.Millisecond,
+		MetricsFormat:   profile.MetricsFormatCSV,
+	}
+	prof := profile.MetricsProfile(cfg)
+	prof.Start()
+	defer prof.Stop()
+}
+
+// Report goroutine stacks whose count kept growing, capturing stacks every 10 seconds
+func GoroutineLeakDetection() {
+	cfg := &profile.Config{
+		GoroutineLeakDetection: true,
+		GoroutineLeakInterval:  10 * time.Second,
+	}
+	prof := profile.GoroutineProfile(cfg)
+	prof.Start()
+	defer prof.Stop()
+}
+
+// Keep the last 30 seconds of execution trace, dump it to file when a trigger fires or on demand
+func TraceFlightRecorderProfile() {
+	slowRequests := make(chan struct{})
+	cfg := &profile.Config{
+		FlightRecorderWindow:  30 * time.Second,
+		FlightRecorderTrigger: slowRequests,
+	}
+	prof := profile.TraceFlightRecorderProfile(cfg)
+	prof.Start()
+	defer prof.Stop()
+
+	// ... a request took too long
+	slowRequests <- struct{}{}
+
+	// ... something unexpected happened
+	_, _ = prof.Dump()
+}
+
 func ThreadCreationProfile() {
 	cfg := &profile.Config{}
 	prof := profile.ThreadCreationProfile(cfg)
@@ -0,0 +1,128 @@
+package profile_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+func TestFileModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes not supported on windows")
+	}
+
+	dir := filepath.Join(t.TempDir(), "profiles")
+	profile.BlockProfile(&profile.Config{Path: dir, Quiet: true, Manifest: true}).Start().Stop()
+
+	info, err := os.Stat(dir)
+	if assert.NoError(t, err) {
+		assert.Equal(t, profile.DefaultDirMode, info.Mode().Perm())
+	}
+	for _, name := range []string{"block.pprof", "block.manifest.json"} {
+		info, err = os.Stat(filepath.Join(dir, name))
+		if assert.NoError(t, err) {
+			assert.Equal(t, profile.DefaultFileMode, info.Mode().Perm(), name)
+		}
+	}
+
+	profile.BlockProfile(&profile.Config{Path: dir, Quiet: true, FileMode: 0640, FileNamePrefix: "shared."}).Start().Stop()
+	info, err = os.Stat(filepath.Join(dir, "shared.block.pprof"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	}
+}
+
+func TestAtomicWrite(t *testing.T) {
+	dir := t.TempDir()
+	profile.BlockProfile(&profile.Config{Path: dir, Quiet: true}).Start().Stop()
+
+	entries, err := ioutil.ReadDir(dir)
+	if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+		assert.Equal(t, "block.pprof", entries[0].Name())
+	}
+}
+
+func TestFailedFlushKeepsPreviousFile(t *testing.T) {
+	dir := t.TempDir()
+	previous := []byte("previous profile")
+	checkErr(t, ioutil.WriteFile(filepath.Join(dir, "cpu.pprof"), previous, 0600))
+
+	// a second CPU profile can not start while the first one runs
+	running := profile.CPUProfile(&profile.Config{Path: t.TempDir(), Quiet: true}).Start()
+	var result profile.Result
+	profile.CPUProfile(&profile.Config{Path: dir, Quiet: true, ResultHook: func(r profile.Result) { result = r }}).Start().Stop()
+	running.Stop()
+
+	assert.Error(t, result.Err)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "cpu.pprof"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, previous, data)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if assert.NoError(t, err) {
+		assert.Len(t, entries, 1)
+	}
+}
+
+func TestFailedSessionSkipsPostFlush(t *testing.T) {
+	dir := t.TempDir()
+	profile.CPUProfile(&profile.Config{Path: dir, Quiet: true}).Start().Stop()
+	path := filepath.Join(dir, "cpu.pprof")
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	checkErr(t, os.Chtimes(path, past, past))
+	previous, err := ioutil.ReadFile(path)
+	checkErr(t, err)
+
+	// a second CPU profile can not start while the first one runs
+	running := profile.CPUProfile(&profile.Config{Path: t.TempDir(), Quiet: true}).Start()
+	before := profile.ReadSelfMetrics().Modes["cpu"]
+	var result profile.Result
+	profile.CPUProfile(&profile.Config{
+		Path:          dir,
+		Quiet:         true,
+		EmbedMetadata: true,
+		Labels:        map[string]string{"service": "test-svc"},
+		Manifest:      true,
+		TopN:          5,
+		ResultHook:    func(r profile.Result) { result = r },
+	}).Start().Stop()
+	after := profile.ReadSelfMetrics().Modes["cpu"]
+	running.Stop()
+
+	// the previous file is neither rewritten nor reported as the output of the failed session
+	assert.Error(t, result.Err)
+	assert.Zero(t, result.Size)
+	data, err := ioutil.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, previous, data)
+	}
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.True(t, info.ModTime().Equal(past))
+	}
+	assert.NoFileExists(t, filepath.Join(dir, "cpu.manifest.json"))
+	assert.Equal(t, before.FlushCount, after.FlushCount)
+	assert.Equal(t, before.BytesWritten, after.BytesWritten)
+}
+
+func TestThreadCreationProfileFile(t *testing.T) {
+	dir := t.TempDir()
+	var result profile.Result
+	profile.ThreadCreationProfile(&profile.Config{
+		Path: dir, Quiet: true, ResultHook: func(r profile.Result) { result = r },
+	}).Start().Stop()
+
+	assert.NoError(t, result.Err)
+	info, err := os.Stat(filepath.Join(dir, "thread.pprof"))
+	if assert.NoError(t, err) {
+		assert.True(t, info.Size() > 0)
+		assert.Equal(t, info.Size(), result.Size)
+	}
+}
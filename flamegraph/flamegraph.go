@@ -0,0 +1,119 @@
+// Package flamegraph renders profiles written by multi-profile as flame graphs, without requiring "go tool pprof"
+package flamegraph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	pprofile "github.com/google/pprof/profile"
+
+	"github.com/bygui86/multi-profile/v2/analysis"
+)
+
+// node represents a frame of the flame graph, holding the cumulative value of its stack
+type node struct {
+	name     string
+	value    int64
+	children map[string]*node
+}
+
+// child returns the child frame with the given name, creating it if missing
+func (n *node) child(name string) *node {
+	c, ok := n.children[name]
+	if !ok {
+		c = &node{name: name, children: make(map[string]*node)}
+		n.children[name] = c
+	}
+	return c
+}
+
+// sortedChildren returns the child frames sorted by name, same as flamegraph.pl
+func (n *node) sortedChildren() []*node {
+	children := make([]*node, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].name < children[j].name
+	})
+	return children
+}
+
+// depth returns the number of frame levels below this node
+func (n *node) depth() int {
+	maxDepth := 0
+	for _, c := range n.children {
+		d := c.depth() + 1
+		if d > maxDepth {
+			maxDepth = d
+		}
+	}
+	return maxDepth
+}
+
+/*
+	Folded writes the profile in collapsed-stack ("folded") text format, one line per stack from root to leaf
+	with its value (e.g. "main.main;main.handler;main.leaf 42"), as consumed by flamegraph.pl and speedscope.
+	If sampleType is blank, the profile default sample type is used.
+*/
+func Folded(w io.Writer, prof *pprofile.Profile, sampleType string) error {
+	idx, err := analysis.SampleIndex(prof, sampleType)
+	if err != nil {
+		return err
+	}
+
+	stacks := make(map[string]int64)
+	for _, sample := range prof.Sample {
+		value := sample.Value[idx]
+		if value <= 0 {
+			continue
+		}
+		functions := analysis.StackFunctions(sample)
+		if len(functions) == 0 {
+			continue
+		}
+		reverse(functions)
+		stacks[strings.Join(functions, ";")] += value
+	}
+
+	keys := make([]string, 0, len(stacks))
+	for key := range stacks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf := bufio.NewWriter(w)
+	for _, key := range keys {
+		fmt.Fprintf(buf, "%s %d\n", key, stacks[key])
+	}
+	return buf.Flush()
+}
+
+// buildTree builds the frames tree of the profile, the root frame holds the total value
+func buildTree(prof *pprofile.Profile, idx int) *node {
+	root := &node{name: "all", children: make(map[string]*node)}
+	for _, sample := range prof.Sample {
+		value := sample.Value[idx]
+		if value <= 0 {
+			continue
+		}
+		functions := analysis.StackFunctions(sample)
+		root.value += value
+		current := root
+		for i := len(functions) - 1; i >= 0; i-- {
+			current = current.child(functions[i])
+			current.value += value
+		}
+	}
+	return root
+}
+
+// reverse reverses the given slice in place
+func reverse(values []string) {
+	for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+		values[i], values[j] = values[j], values[i]
+	}
+}
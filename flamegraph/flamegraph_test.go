@@ -0,0 +1,73 @@
+package flamegraph_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	pprofile "github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2/flamegraph"
+)
+
+// buildProfile builds a goroutine-like profile with one sample per stack, stacks are listed from leaf to root
+func buildProfile(stacks [][]string, values []int64) *pprofile.Profile {
+	prof := &pprofile.Profile{
+		SampleType: []*pprofile.ValueType{{Type: "goroutine", Unit: "count"}},
+		PeriodType: &pprofile.ValueType{Type: "goroutine", Unit: "count"},
+		Period:     1,
+	}
+
+	locations := make(map[string]*pprofile.Location)
+	for idx, stack := range stacks {
+		sample := &pprofile.Sample{Value: []int64{values[idx]}}
+		for _, name := range stack {
+			loc, ok := locations[name]
+			if !ok {
+				fn := &pprofile.Function{ID: uint64(len(locations) + 1), Name: name}
+				prof.Function = append(prof.Function, fn)
+				loc = &pprofile.Location{ID: fn.ID, Line: []pprofile.Line{{Function: fn}}}
+				locations[name] = loc
+				prof.Location = append(prof.Location, loc)
+			}
+			sample.Location = append(sample.Location, loc)
+		}
+		prof.Sample = append(prof.Sample, sample)
+	}
+	return prof
+}
+
+func TestFolded(t *testing.T) {
+	prof := buildProfile(
+		[][]string{{"main.leaf", "main.main"}, {"main.other", "main.main"}, {"main.leaf", "main.main"}},
+		[]int64{2, 3, 4},
+	)
+
+	buf := &bytes.Buffer{}
+	err := flamegraph.Folded(buf, prof, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "main.main;main.leaf 6\nmain.main;main.other 3\n", buf.String())
+}
+
+func TestSVG(t *testing.T) {
+	prof := buildProfile([][]string{{"main.leaf", "main.main"}, {"main.other<T>", "main.main"}}, []int64{2, 3})
+
+	buf := &bytes.Buffer{}
+	err := flamegraph.SVG(buf, prof, flamegraph.Options{})
+	assert.NoError(t, err)
+
+	assert.Contains(t, buf.String(), "<svg")
+	assert.Contains(t, buf.String(), "main.leaf (2, 40.00%)")
+	assert.Contains(t, buf.String(), "main.other&lt;T&gt;")
+
+	// output must be well-formed XML
+	decoder := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for {
+		_, err := decoder.Token()
+		if err != nil {
+			assert.Equal(t, "EOF", err.Error())
+			break
+		}
+	}
+}
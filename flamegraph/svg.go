@@ -0,0 +1,151 @@
+package flamegraph
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+
+	pprofile "github.com/google/pprof/profile"
+
+	"github.com/bygui86/multi-profile/v2/analysis"
+)
+
+const (
+	// DefaultWidth holds the default width in pixels of the SVG flame graph
+	DefaultWidth = 1200
+
+	// DefaultMinFrameWidth holds the default width in pixels under which frames are not drawn
+	DefaultMinFrameWidth = 0.1
+
+	frameHeight = 16
+	padding     = 10
+	titleHeight = 40
+	charWidth   = 7
+	fontSize    = 12
+)
+
+// Options holds configurations to render an SVG flame graph
+type Options struct {
+	/*
+		SampleType holds the sample type to render (e.g. cpu, alloc_space, inuse_space, goroutine)
+		If blank, the profile default sample type is used
+	*/
+	SampleType string
+
+	// Title holds the title shown on top of the flame graph, if blank it is "Flame Graph (<sample type>)"
+	Title string
+
+	// Width holds the width in pixels of the flame graph, see DefaultWidth for default value
+	Width int
+
+	// MinFrameWidth holds the width in pixels under which frames are not drawn, see DefaultMinFrameWidth for default value
+	MinFrameWidth float64
+}
+
+// svgRenderer holds the state needed to draw frames
+type svgRenderer struct {
+	w      *bufio.Writer
+	unit   string
+	total  int64
+	scale  float64
+	height int
+	minW   float64
+}
+
+/*
+	SVG writes the profile as self-contained SVG flame graph: the root frame is at the bottom, each frame width is
+	proportional to its cumulative value and hovering a frame shows its function name and value.
+*/
+func SVG(w io.Writer, prof *pprofile.Profile, opts Options) error {
+	idx, err := analysis.SampleIndex(prof, opts.SampleType)
+	if err != nil {
+		return err
+	}
+	sampleType := prof.SampleType[idx]
+
+	if opts.Width <= 0 {
+		opts.Width = DefaultWidth
+	}
+	if opts.MinFrameWidth <= 0 {
+		opts.MinFrameWidth = DefaultMinFrameWidth
+	}
+	if opts.Title == "" {
+		opts.Title = fmt.Sprintf("Flame Graph (%s)", sampleType.Type)
+	}
+
+	root := buildTree(prof, idx)
+	height := titleHeight + (root.depth()+1)*frameHeight + padding
+	renderer := &svgRenderer{
+		w:      bufio.NewWriter(w),
+		unit:   sampleType.Unit,
+		total:  root.value,
+		height: height,
+		minW:   opts.MinFrameWidth,
+	}
+	if root.value > 0 {
+		renderer.scale = float64(opts.Width-2*padding) / float64(root.value)
+	}
+
+	fmt.Fprintf(renderer.w, `<?xml version="1.0" standalone="no"?>
+<svg version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg">
+<rect x="0" y="0" width="100%%" height="100%%" fill="#f8f8f8"/>
+<text x="%d" y="24" font-family="Verdana" font-size="17" text-anchor="middle">%s</text>
+<g font-family="Verdana" font-size="%d">
+`, opts.Width, height, opts.Width, height, opts.Width/2, html.EscapeString(opts.Title), fontSize)
+
+	if root.value > 0 {
+		renderer.drawFrame(root, padding, 0)
+	} else {
+		fmt.Fprintf(renderer.w, `<text x="%d" y="%d" text-anchor="middle">No samples</text>
+`, opts.Width/2, height/2)
+	}
+
+	fmt.Fprint(renderer.w, "</g>\n</svg>\n")
+	return renderer.w.Flush()
+}
+
+// drawFrame draws the given frame and its children, level 0 is the root frame at the bottom
+func (r *svgRenderer) drawFrame(n *node, x float64, level int) {
+	width := float64(n.value) * r.scale
+	if width < r.minW {
+		return
+	}
+	y := r.height - padding - (level+1)*frameHeight
+
+	fmt.Fprintf(r.w, `<g><title>%s (%s, %.2f%%)</title><rect x="%.2f" y="%d" width="%.2f" height="%d" fill="%s" rx="2" ry="2"/>`,
+		html.EscapeString(n.name), analysis.FormatValue(n.value, r.unit), float64(n.value)*100/float64(r.total),
+		x, y, width, frameHeight-1, frameColor(n.name))
+	label := frameLabel(n.name, width)
+	if label != "" {
+		fmt.Fprintf(r.w, `<text x="%.2f" y="%d">%s</text>`, x+3, y+fontSize, html.EscapeString(label))
+	}
+	fmt.Fprint(r.w, "</g>\n")
+
+	childX := x
+	for _, c := range n.sortedChildren() {
+		r.drawFrame(c, childX, level+1)
+		childX += float64(c.value) * r.scale
+	}
+}
+
+// frameLabel returns the function name truncated to fit the frame width, blank if there is no room
+func frameLabel(name string, width float64) string {
+	maxChars := int((width - 6) / charWidth)
+	if maxChars < 3 {
+		return ""
+	}
+	if len(name) <= maxChars {
+		return name
+	}
+	return name[:maxChars-2] + ".."
+}
+
+// frameColor returns a warm color derived from the function name, so the same function always has the same color
+func frameColor(name string) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(name))
+	sum := hash.Sum32()
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+sum%50, (sum>>8)%230, (sum>>16)%55)
+}
@@ -0,0 +1,194 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFlightRecorderWindow holds the default minimum age of the execution trace kept by the flight recorder
+	DefaultFlightRecorderWindow = 10 * time.Second
+
+	// DefaultFlightRecorderMaxBytes holds the default maximum size of the execution trace kept by the flight recorder
+	DefaultFlightRecorderMaxBytes = 10 << 20
+)
+
+// flightRecorder abstracts the in-memory ring keeping the most recent execution trace
+type flightRecorder interface {
+	// start starts recording the execution trace
+	start() error
+
+	// writeTo writes the most recent window of the execution trace to the given file
+	writeTo(file *os.File) error
+
+	// stop stops recording and discards the execution trace kept in memory
+	stop()
+}
+
+// flightRecorderState holds flight recorder configurations and state of a profile
+type flightRecorderState struct {
+	window   time.Duration
+	maxBytes uint64
+	signals  []os.Signal
+	trigger  <-chan struct{}
+
+	// recorder holds the flight recorder implementation, see newFlightRecorder
+	recorder flightRecorder
+
+	// dumpMu serializes dumps, that can be requested concurrently by Dump, signals and trigger
+	dumpMu sync.Mutex
+
+	// doneCh is closed on Stop to terminate the goroutine waiting for signals and trigger
+	doneCh chan struct{}
+}
+
+/*
+	TraceFlightRecorderProfile creates an execution tracing profiling object that keeps only the most recent
+	window of execution trace in memory, suitable for always-on use. The window is written to a new file on demand
+	(see Profile.Dump), on FlightRecorderSignals or when FlightRecorderTrigger fires.
+*/
+func TraceFlightRecorderProfile(cfg *Config) *Profile {
+	// INFO: lookupName not required, fileName changes on every dump
+	flightPprof := buildProfile(flightMode, "", "trace-flight.pprof", cfg)
+	flightPprof.flight = &flightRecorderState{
+		window:   DefaultFlightRecorderWindow,
+		maxBytes: DefaultFlightRecorderMaxBytes,
+		signals:  cfg.FlightRecorderSignals,
+		trigger:  cfg.FlightRecorderTrigger,
+	}
+	if cfg.FlightRecorderWindow > 0 {
+		flightPprof.flight.window = cfg.FlightRecorderWindow
+	}
+	if cfg.FlightRecorderMaxBytes > 0 {
+		flightPprof.flight.maxBytes = cfg.FlightRecorderMaxBytes
+	}
+	return flightPprof
+}
+
+/*
+	Dump writes the most recent window of execution trace to a new file, returning its path.
+	Available only for profiles created with TraceFlightRecorderProfile.
+*/
+func (p *Profile) Dump() (string, error) {
+	if p.mode != flightMode {
+		return "", fmt.Errorf("%s profiling does not support dump", string(p.mode))
+	}
+
+	p.flight.dumpMu.Lock()
+	defer p.flight.dumpMu.Unlock()
+
+	if p.flight.recorder == nil {
+		return "", fmt.Errorf("%s profiling not started", string(p.mode))
+	}
+
+	// every dump is a capture on its own, a previous failed dump must not prevent sending this one
+	p.setErr(nil)
+	p.location = ""
+
+	dumpTime := time.Now()
+	p.fileName = fmt.Sprintf("%strace-flight-%s.pprof", p.fileNamePrefix, dumpTime.Format("20060102-150405.000"))
+	p.createFile()
+	if p.file == nil {
+		return "", fmt.Errorf("%s profiling dump file %s creation failed", string(p.mode), p.filePath)
+	}
+
+	err := p.flight.recorder.writeTo(p.file)
+	if err != nil {
+		p.failf("%s profiling dump to file %s failed: %s", string(p.mode), p.filePath, err.Error())
+	}
+	closeErr := p.closeFile()
+	if err == nil && closeErr != nil {
+		err = closeErr
+		p.failf("%s profiling dump to file %s failed: %s", string(p.mode), p.filePath, err.Error())
+	}
+	if err != nil {
+		return "", err
+	}
+
+	p.recordFlush(time.Since(dumpTime))
+	p.logf(LevelInfo, "%s profiling dumped to file %s", string(p.mode), p.filePath)
+
+	p.stopTime = dumpTime
+	if p.manifest {
+		p.writeManifest()
+	}
+	p.sendToSinks()
+	p.notify()
+	return p.filePath, nil
+}
+
+// startFlightMode starts trace flight recorder profiling
+func (p *Profile) startFlightMode() {
+	p.flight.dumpMu.Lock()
+	defer p.flight.dumpMu.Unlock()
+
+	recorder := newFlightRecorder(p.flight.window, p.flight.maxBytes)
+	err := recorder.start()
+	if err != nil {
+		p.failf("%s profiling start failed: %s", string(p.mode), err.Error())
+		if p.panicIfFail {
+			panic(err)
+		}
+		return
+	}
+	p.flight.recorder = recorder
+	p.flight.doneCh = make(chan struct{})
+	go p.waitFlightDumpRequests(p.flight.doneCh)
+
+	p.internalCloser = p.stopFlightMode
+
+	p.logf(LevelInfo, "%s profiling enabled with window %s, dumps in %s",
+		string(p.mode), p.flight.window.String(), filepath.Join(p.path, p.fileNamePrefix+"trace-flight-<timestamp>.pprof"))
+}
+
+// stopFlightMode stops trace flight recorder profiling, discarding the execution trace kept in memory
+func (p *Profile) stopFlightMode() {
+	close(p.flight.doneCh)
+
+	p.flight.dumpMu.Lock()
+	defer p.flight.dumpMu.Unlock()
+
+	p.flight.recorder.stop()
+	p.flight.recorder = nil
+
+	// dumps are reported on their own, the session result at Stop refers to no file
+	p.filePath = ""
+	p.size = 0
+	p.location = ""
+
+	p.logf(LevelInfo, "%s profiling disabled", string(p.mode))
+}
+
+// waitFlightDumpRequests dumps the recent execution trace on signals and trigger, until doneCh is closed
+func (p *Profile) waitFlightDumpRequests(doneCh chan struct{}) {
+	var signalCh chan os.Signal
+	if len(p.flight.signals) > 0 {
+		signalCh = make(chan os.Signal, 1)
+		signal.Notify(signalCh, p.flight.signals...)
+		defer signal.Stop(signalCh)
+	}
+
+	for {
+		select {
+		case sig := <-signalCh:
+			p.logf(LevelInfo, "Caught signal %s, dump %s profiling", sig.String(), string(p.mode))
+			_, _ = p.Dump()
+
+		case _, ok := <-p.flight.trigger:
+			if !ok {
+				// trigger closed, keep waiting only for signals
+				p.flight.trigger = nil
+				continue
+			}
+			p.logf(LevelInfo, "Trigger fired, dump %s profiling", string(p.mode))
+			_, _ = p.Dump()
+
+		case <-doneCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,38 @@
+//go:build go1.25
+// +build go1.25
+
+package profile
+
+import (
+	"os"
+	"runtime/trace"
+	"time"
+)
+
+// runtimeFlightRecorder keeps the most recent execution trace using the runtime flight recorder
+type runtimeFlightRecorder struct {
+	recorder *trace.FlightRecorder
+}
+
+// newFlightRecorder creates the runtime flight recorder, available since Go 1.25
+func newFlightRecorder(window time.Duration, maxBytes uint64) flightRecorder {
+	return &runtimeFlightRecorder{
+		recorder: trace.NewFlightRecorder(trace.FlightRecorderConfig{
+			MinAge:   window,
+			MaxBytes: maxBytes,
+		}),
+	}
+}
+
+func (r *runtimeFlightRecorder) start() error {
+	return r.recorder.Start()
+}
+
+func (r *runtimeFlightRecorder) writeTo(file *os.File) error {
+	_, err := r.recorder.WriteTo(file)
+	return err
+}
+
+func (r *runtimeFlightRecorder) stop() {
+	r.recorder.Stop()
+}
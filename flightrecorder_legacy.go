@@ -0,0 +1,154 @@
+//go:build !go1.25
+// +build !go1.25
+
+package profile
+
+import (
+	"bytes"
+	"os"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+/*
+	rotatingFlightRecorder approximates the flight recorder before Go 1.25, restarting the execution trace
+	in memory every window (or earlier when maxBytes is exceeded).
+	Execution traces can not be concatenated, so a dump contains a single segment: the current one, or the previous
+	complete one while the current one is younger than half window. Up to two segments are kept in memory.
+*/
+type rotatingFlightRecorder struct {
+	window   time.Duration
+	maxBytes uint64
+
+	mu       sync.Mutex
+	segment  *lockedBuffer
+	previous *lockedBuffer
+	started  time.Time
+	tracing  bool // whether the running execution trace is the one started by this recorder
+	doneCh   chan struct{}
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent writes by the tracer and reads by the recorder
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(data)
+}
+
+// Bytes returns a copy of the buffer content, the buffer keeps it for later dumps
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func (b *lockedBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+// newFlightRecorder creates the rotating flight recorder, used before Go 1.25
+func newFlightRecorder(window time.Duration, maxBytes uint64) flightRecorder {
+	return &rotatingFlightRecorder{window: window, maxBytes: maxBytes}
+}
+
+func (r *rotatingFlightRecorder) start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.startSegment()
+	if err != nil {
+		return err
+	}
+	r.doneCh = make(chan struct{})
+	go r.rotate(r.doneCh)
+	return nil
+}
+
+func (r *rotatingFlightRecorder) writeTo(file *os.File) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.previous != nil && time.Since(r.started) < r.window/2 {
+		// the current segment holds almost nothing, the previous one holds the last window
+		_, err := file.Write(r.previous.Bytes())
+		return err
+	}
+
+	restartErr := r.restartSegment()
+	_, err := file.Write(r.previous.Bytes())
+	if err != nil {
+		return err
+	}
+	return restartErr
+}
+
+func (r *rotatingFlightRecorder) stop() {
+	if r.doneCh != nil {
+		close(r.doneCh)
+		r.doneCh = nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stopSegment()
+	r.segment = nil
+	r.previous = nil
+}
+
+// restartSegment stops tracing, keeping the current segment as the previous one, then starts a new segment
+func (r *rotatingFlightRecorder) restartSegment() error {
+	r.stopSegment()
+	r.previous = r.segment
+	return r.startSegment()
+}
+
+// startSegment starts tracing into a new in-memory segment
+func (r *rotatingFlightRecorder) startSegment() error {
+	r.segment = &lockedBuffer{}
+	r.started = time.Now()
+	err := trace.Start(r.segment)
+	r.tracing = err == nil
+	return err
+}
+
+// stopSegment stops tracing if this recorder started it, leaving alone any trace started by someone else
+func (r *rotatingFlightRecorder) stopSegment() {
+	if r.tracing {
+		trace.Stop()
+		r.tracing = false
+	}
+}
+
+// rotate restarts the execution trace when the segment is older than window or larger than maxBytes
+func (r *rotatingFlightRecorder) rotate(doneCh chan struct{}) {
+	interval := r.window / 10
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.Lock()
+			if r.segment != nil &&
+				(time.Since(r.started) >= r.window || uint64(r.segment.Len()) >= r.maxBytes) {
+				_ = r.restartSegment()
+			}
+			r.mu.Unlock()
+
+		case <-doneCh:
+			return
+		}
+	}
+}
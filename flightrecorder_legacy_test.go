@@ -0,0 +1,67 @@
+//go:build !go1.25
+// +build !go1.25
+
+package profile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/trace"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFlightRecorderDumpAfterRotation(t *testing.T) {
+	recorder := newFlightRecorder(200*time.Millisecond, DefaultFlightRecorderMaxBytes).(*rotatingFlightRecorder)
+	if !assert.NoError(t, recorder.start()) {
+		return
+	}
+	defer recorder.stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	var previous []byte
+	for previous == nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		recorder.mu.Lock()
+		if recorder.previous != nil && time.Since(recorder.started) < recorder.window/2 {
+			previous = recorder.previous.Bytes()
+		}
+		recorder.mu.Unlock()
+	}
+	if !assert.NotEmpty(t, previous, "no rotation") {
+		return
+	}
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "trace.pprof"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+	assert.NoError(t, recorder.writeTo(file))
+	info, err := file.Stat()
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(len(previous)), info.Size())
+	}
+}
+
+func TestRotatingFlightRecorderTinyWindow(t *testing.T) {
+	recorder := newFlightRecorder(time.Nanosecond, DefaultFlightRecorderMaxBytes)
+	assert.NoError(t, recorder.start())
+	time.Sleep(10 * time.Millisecond)
+	recorder.stop()
+}
+
+func TestRotatingFlightRecorderKeepsForeignTrace(t *testing.T) {
+	if !assert.NoError(t, trace.Start(ioutil.Discard)) {
+		return
+	}
+	defer trace.Stop()
+
+	recorder := newFlightRecorder(time.Second, DefaultFlightRecorderMaxBytes)
+	assert.Error(t, recorder.start())
+	recorder.stop()
+	assert.True(t, trace.IsEnabled(), "trace started by someone else stopped")
+}
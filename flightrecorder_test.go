@@ -0,0 +1,43 @@
+package profile_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+func TestTraceFlightRecorder(t *testing.T) {
+	dir := t.TempDir()
+	trigger := make(chan struct{})
+	prof := profile.TraceFlightRecorderProfile(&profile.Config{
+		Path:                  dir,
+		Quiet:                 true,
+		FlightRecorderWindow:  time.Second,
+		FlightRecorderTrigger: trigger,
+	}).Start()
+
+	time.Sleep(50 * time.Millisecond)
+	dumpPath, err := prof.Dump()
+	checkErr(t, err)
+	data, err := ioutil.ReadFile(dumpPath)
+	checkErr(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte("go 1.")), "dump must start with the execution trace header")
+
+	// wait for dump file names, holding milliseconds, to differ
+	time.Sleep(10 * time.Millisecond)
+	trigger <- struct{}{}
+	assert.Eventually(t, func() bool {
+		dumps, _ := filepath.Glob(filepath.Join(dir, "trace-flight-*.pprof"))
+		return len(dumps) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	prof.Stop()
+	_, err = prof.Dump()
+	assert.Error(t, err)
+}
@@ -2,4 +2,7 @@ module github.com/bygui86/multi-profile/v2
 
 go 1.15
 
-require github.com/stretchr/testify v1.6.1
+require (
+	github.com/google/pprof v0.0.0-20210407192527-94a9f03dee38
+	github.com/stretchr/testify v1.6.1
+)
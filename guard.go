@@ -0,0 +1,197 @@
+package profile
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+// activeProfiles holds the profiles currently running, in start order, flushed by Recover on panic
+var activeProfiles = &profileRegistry{}
+
+// profileRegistry holds a set of profiles in insertion order
+type profileRegistry struct {
+	mu       sync.Mutex
+	profiles []*Profile
+}
+
+// add adds the profile to the registry
+func (r *profileRegistry) add(p *Profile) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.profiles = append(r.profiles, p)
+}
+
+// remove removes the profile from the registry, if present
+func (r *profileRegistry) remove(p *Profile) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, active := range r.profiles {
+		if active == p {
+			r.profiles = append(r.profiles[:i], r.profiles[i+1:]...)
+			return
+		}
+	}
+}
+
+// list returns the profiles in the registry, in insertion order
+func (r *profileRegistry) list() []*Profile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Profile(nil), r.profiles...)
+}
+
+// takeAll removes all profiles from the registry, returning them in insertion order
+func (r *profileRegistry) takeAll() []*Profile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	profiles := r.profiles
+	r.profiles = nil
+	return profiles
+}
+
+var (
+	// panicMu guards panic handling state, it is never held while flushing profiles
+	panicMu sync.Mutex
+
+	// panicFlushes holds the number of panic flushes in progress
+	panicFlushes int
+
+	// panicFlushesDone is signalled every time a panic flush completes
+	panicFlushesDone = sync.NewCond(&panicMu)
+)
+
+/*
+	Recover flushes all active profiles and writes a goroutine dump if the calling goroutine panics, then re-panics
+	It must be deferred directly, at the top of every goroutine whose panic should not lose the profiles:
+
+		go func() {
+			defer profile.Recover()
+			...
+		}()
+
+	Deferred Stop calls run only in the panicking goroutine, a panic in any other goroutine kills the process
+	See flushOnPanic for what happens on panic
+*/
+func Recover() {
+	if r := recover(); r != nil {
+		flushOnPanic(r)
+		panic(r)
+	}
+}
+
+// Guard runs fn, flushing all active profiles and writing a goroutine dump if it panics, then re-panics, see Recover
+func Guard(fn func()) {
+	defer Recover()
+	fn()
+}
+
+/*
+	RecoverHandler wraps the given handler writing a goroutine dump if it panics, then re-panics
+	Profiles keep running, as net/http recovers handler panics and keeps serving
+	http.ErrAbortHandler panics abort the request only, they are re-panicked without dump
+*/
+func RecoverHandler(next http.Handler) http.Handler {
+	return recoverHandler(next, dumpOnPanic)
+}
+
+/*
+	FlushingRecoverHandler wraps the given handler flushing all active profiles and writing a goroutine dump if it
+	panics, then re-panics, see Recover
+	Use it only if a handler panic takes the server down, as net/http recovers handler panics and keeps serving
+	with the profiles stopped
+	http.ErrAbortHandler panics abort the request only, they are re-panicked without flushing
+*/
+func FlushingRecoverHandler(next http.Handler) http.Handler {
+	return recoverHandler(next, flushOnPanic)
+}
+
+// recoverHandler wraps the given handler calling onPanic if it panics, except for http.ErrAbortHandler, then re-panics
+func recoverHandler(next http.Handler, onPanic func(reason interface{})) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec != http.ErrAbortHandler {
+					onPanic(rec)
+				}
+				panic(rec)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// dumpOnPanic writes a goroutine dump, see writeGoroutineDump
+func dumpOnPanic(reason interface{}) {
+	panicMu.Lock()
+	defer panicMu.Unlock()
+
+	writeGoroutineDump(activeProfiles.list(), reason)
+}
+
+/*
+	flushOnPanic writes a goroutine dump (with full stacks, as printed by a crash) then stops all active profiles,
+	last started first, so profile files, sinks, notifiers and hooks complete before the process dies
+	Flight recorder profiles are dumped before being stopped
+	The goroutine dump is written next to the files of the first started profile, to stderr if none is active
+	Profiles are claimed by the first panic, later panics in other goroutines wait for its flush before going on
+*/
+func flushOnPanic(reason interface{}) {
+	panicMu.Lock()
+	profiles := activeProfiles.takeAll()
+	writeGoroutineDump(profiles, reason)
+	panicFlushes++
+	panicMu.Unlock()
+
+	defer waitPanicFlushes()
+
+	for i := len(profiles) - 1; i >= 0; i-- {
+		p := profiles[i]
+		p.logf(LevelError, "Panic caught: %v, stop and flush %s profiling", reason, string(p.mode))
+		if p.mode == flightMode {
+			// the most recent window of execution trace is the one leading to the panic
+			_, _ = p.Dump()
+		}
+		p.Stop()
+	}
+}
+
+// waitPanicFlushes marks a panic flush as completed, then waits for the ones of other goroutines, see flushOnPanic
+func waitPanicFlushes() {
+	panicMu.Lock()
+	defer panicMu.Unlock()
+
+	panicFlushes--
+	panicFlushesDone.Broadcast()
+	for panicFlushes > 0 {
+		panicFlushesDone.Wait()
+	}
+}
+
+// writeGoroutineDump writes the stacks of all goroutines, see flushOnPanic
+func writeGoroutineDump(profiles []*Profile, reason interface{}) {
+	var dump bytes.Buffer
+	fmt.Fprintf(&dump, "panic: %v\n\n", reason)
+	_ = pprof.Lookup("goroutine").WriteTo(&dump, 2)
+
+	if len(profiles) == 0 {
+		_, _ = os.Stderr.Write(dump.Bytes())
+		return
+	}
+
+	p := profiles[0]
+	dumpPath := filepath.Join(p.path, fmt.Sprintf("%spanic-goroutines-%s.txt",
+		p.fileNamePrefix, time.Now().Format("20060102-150405.000")))
+	err := p.writeFile(dumpPath, dump.Bytes())
+	if err != nil {
+		p.logf(LevelError, "Panic goroutine dump file %s creation failed: %s", dumpPath, err.Error())
+		_, _ = os.Stderr.Write(dump.Bytes())
+		return
+	}
+	p.logf(LevelError, "Panic goroutine dump written to file %s", dumpPath)
+}
@@ -0,0 +1,133 @@
+package profile_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+func TestGuard(t *testing.T) {
+	dir := t.TempDir()
+	results := 0
+	cfg := &profile.Config{Path: dir, Quiet: true, ResultHook: func(profile.Result) { results++ }}
+	prof := profile.BlockProfile(cfg).Start()
+
+	assert.PanicsWithValue(t, "boom", func() {
+		profile.Guard(func() { panic("boom") })
+	})
+	assert.Equal(t, 1, results)
+	prof.Stop()
+	assert.Equal(t, 1, results)
+
+	_, err := os.Stat(filepath.Join(dir, "block.pprof"))
+	assert.NoError(t, err)
+	dumps, err := filepath.Glob(filepath.Join(dir, "panic-goroutines-*.txt"))
+	if assert.NoError(t, err) && assert.Len(t, dumps, 1) {
+		data, err := ioutil.ReadFile(dumps[0])
+		if assert.NoError(t, err) {
+			assert.True(t, strings.HasPrefix(string(data), "panic: boom\n"))
+			assert.Contains(t, string(data), "guard_test.go")
+		}
+	}
+}
+
+func TestGuardNoPanic(t *testing.T) {
+	prof := profile.BlockProfile(&profile.Config{Path: t.TempDir(), Quiet: true}).Start()
+	defer prof.Stop()
+
+	called := false
+	profile.Guard(func() { called = true })
+	assert.True(t, called)
+}
+
+func TestRecoverHandler(t *testing.T) {
+	dir := t.TempDir()
+	results := 0
+	cfg := &profile.Config{Path: dir, Quiet: true, ResultHook: func(profile.Result) { results++ }}
+	prof := profile.BlockProfile(cfg).Start()
+	defer prof.Stop()
+
+	abort := profile.RecoverHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	dumps, err := filepath.Glob(filepath.Join(dir, "panic-goroutines-*.txt"))
+	if assert.NoError(t, err) {
+		assert.Empty(t, dumps)
+	}
+
+	// net/http keeps serving after a handler panic, profiles keep running
+	crash := profile.RecoverHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+	assert.PanicsWithValue(t, "boom", func() {
+		crash.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	assert.Equal(t, 0, results)
+	dumps, err = filepath.Glob(filepath.Join(dir, "panic-goroutines-*.txt"))
+	if assert.NoError(t, err) {
+		assert.Len(t, dumps, 1)
+	}
+}
+
+func TestFlushingRecoverHandler(t *testing.T) {
+	results := 0
+	cfg := &profile.Config{Path: t.TempDir(), Quiet: true, ResultHook: func(profile.Result) { results++ }}
+	prof := profile.BlockProfile(cfg).Start()
+	defer prof.Stop()
+
+	abort := profile.FlushingRecoverHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	assert.Equal(t, 0, results)
+
+	crash := profile.FlushingRecoverHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+	assert.PanicsWithValue(t, "boom", func() {
+		crash.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	assert.Equal(t, 1, results)
+}
+
+func TestGuardDeliveryUnlocked(t *testing.T) {
+	crash := profile.RecoverHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("inner")
+	}))
+	handled := false
+	cfg := &profile.Config{Path: t.TempDir(), Quiet: true, ResultHook: func(profile.Result) {
+		// a panic in another goroutine is handled while the flush delivers, not blocked behind it
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer func() { _ = recover() }()
+			crash.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+		select {
+		case <-done:
+			handled = true
+		case <-time.After(time.Second):
+		}
+	}}
+	prof := profile.BlockProfile(cfg).Start()
+	defer prof.Stop()
+
+	assert.PanicsWithValue(t, "boom", func() {
+		profile.Guard(func() { panic("boom") })
+	})
+	assert.True(t, handled)
+}
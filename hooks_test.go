@@ -0,0 +1,58 @@
+package profile_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+func TestHooks(t *testing.T) {
+	dir := t.TempDir()
+	var calls []string
+	var preStartMode, preStartPath string
+	var result profile.Result
+
+	profile.BlockProfile(&profile.Config{
+		Path:  dir,
+		Quiet: true,
+		PreStartHook: func(mode, filePath string) {
+			calls = append(calls, "pre-start")
+			preStartMode, preStartPath = mode, filePath
+		},
+		ResultHook: func(r profile.Result) {
+			calls = append(calls, "result")
+			result = r
+		},
+		CloserHook: func() {
+			calls = append(calls, "closer")
+		},
+	}).Start().Stop()
+
+	assert.Equal(t, []string{"pre-start", "result", "closer"}, calls)
+	assert.Equal(t, "block", preStartMode)
+	assert.Equal(t, filepath.Join(dir, "block.pprof"), preStartPath)
+
+	assert.Equal(t, "block", result.Mode)
+	assert.Equal(t, filepath.Join(dir, "block.pprof"), result.Path)
+	assert.True(t, result.Size > 0)
+	assert.Equal(t, result.StopTime.Sub(result.StartTime), result.Duration)
+	assert.NoError(t, result.Err)
+}
+
+func TestResultHookError(t *testing.T) {
+	var result profile.Result
+	profile.MetricsProfile(&profile.Config{
+		Path:          t.TempDir(),
+		Quiet:         true,
+		MetricsFormat: "xml",
+		ResultHook:    func(r profile.Result) { result = r },
+	}).Start().Stop()
+
+	assert.Equal(t, "metrics", result.Mode)
+	if assert.Error(t, result.Err) {
+		assert.Contains(t, result.Err.Error(), "unknown format")
+	}
+}
@@ -0,0 +1,520 @@
+/*
+	Package ingest pushes profiles written by multi-profile to a continuous-profiling server, using one of the
+	Pyroscope HTTP APIs (also accepted by compatible backends), see Config.API.
+
+	IngestAPI, the default, takes a single profile per request:
+
+		POST <ServerURL>/ingest?name=<app>.<mode>{<labels>}&from=<unix>&until=<unix>&format=pprof&spyName=gospy
+		Content-Type: application/octet-stream
+
+		<pprof bytes, gzip compressed>
+
+	name holds the application name, followed by the short profiling mode (cpu, mem, mutex, etc) and the labels
+	(Config.Labels plus the profile labels) as comma separated key=value pairs; from and until hold the session start
+	and flush time as unix timestamps in seconds.
+
+	PushAPI takes a batch of profiles per request, as a Connect JSON call (from and until are read from the profiles):
+
+		POST <ServerURL>/push.v1.PusherService/Push
+		Content-Type: application/json
+
+		{"series": [{"labels": [{"name": "__name__", "value": "<type>"}, {"name": "service_name", "value": "<app>"},
+			<labels>], "samples": [{"ID": "<id>", "rawProfile": "<pprof bytes, gzip compressed, base64 encoded>"}]}]}
+
+	__name__ holds the profile type (process_cpu, memory, mutex, block, goroutine, etc), every profile of the batch
+	is a series on its own.
+
+	Pushes are queued and sent by a background worker, so a slow or unreachable server never delays the profiled
+	application: when the bounded queue is full, new profiles are dropped and counted, see Stats. With PushAPI, the
+	worker sends queued profiles together, up to BatchSize per request, waiting at most BatchInterval to fill a batch.
+	Pushes still failing after all retries are logged.
+	Execution traces and metrics timeseries are not pprof profiles, they are skipped.
+*/
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bygui86/multi-profile/v2"
+	"github.com/bygui86/multi-profile/v2/internal/httpretry"
+)
+
+// API identifies the HTTP API profiles are pushed with
+type API string
+
+const (
+	// IngestAPI pushes every profile in a request on its own, with name, labels and times in the query
+	IngestAPI API = "ingest"
+
+	// PushAPI pushes queued profiles in batches, see BatchSize
+	PushAPI API = "push"
+)
+
+const (
+	// DefaultQueueSize holds the default number of profiles waiting to be pushed, above which profiles are dropped
+	DefaultQueueSize = 64
+
+	// DefaultMaxRetries holds the default number of retries of a failed push
+	DefaultMaxRetries = 3
+
+	// DefaultRetryBackoff holds the default interval between a failed push and its first retry
+	DefaultRetryBackoff = 500 * time.Millisecond
+
+	// DefaultTimeout holds the default timeout of a single push request
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultBatchSize holds the default maximum number of profiles of a PushAPI request
+	DefaultBatchSize = 16
+
+	// DefaultBatchInterval holds the default maximum wait of a queued profile for its batch to fill
+	DefaultBatchInterval = time.Second
+
+	// DefaultDrainTimeout holds the default time Close waits for queued profiles to be pushed
+	DefaultDrainTimeout = 10 * time.Second
+)
+
+// pushPath holds the path of the Connect push method of PushAPI
+const pushPath = "/push.v1.PusherService/Push"
+
+// pushProfileTypes holds the profile type names of PushAPI, by profiling mode, other modes keep their name
+var pushProfileTypes = map[string]string{"cpu": "process_cpu", "mem": "memory", "thread": "threadcreate"}
+
+// unsupportedModes holds the profiling modes not writing pprof files, which can not be ingested
+var unsupportedModes = map[string]bool{"trace": true, "flight": true, "metrics": true}
+
+// Config holds configurations to create a new Exporter
+type Config struct {
+	// ServerURL holds the base URL of the ingest server, for example "http://pyroscope:4040"
+	ServerURL string
+
+	// ApplicationName holds the name profiles are ingested under, followed by the profiling mode
+	ApplicationName string
+
+	// Labels holds static labels added to every pushed profile, profile labels take precedence
+	Labels map[string]string
+
+	// AuthToken holds a token sent as "Authorization: Bearer <token>", if not blank
+	AuthToken string
+
+	// API holds the HTTP API profiles are pushed with, IngestAPI if blank
+	API API
+
+	// BatchSize holds the maximum number of profiles pushed in a PushAPI request, see DefaultBatchSize for default
+	BatchSize int
+
+	// BatchInterval holds how long a batch waits for more profiles once started, see DefaultBatchInterval for default
+	BatchInterval time.Duration
+
+	// QueueSize holds the number of profiles waiting to be pushed, see DefaultQueueSize for default
+	QueueSize int
+
+	// MaxRetries holds the number of retries of a failed push, see DefaultMaxRetries for default, below zero for none
+	MaxRetries int
+
+	// RetryBackoff holds the interval before the first retry of a push, doubling on later ones, see DefaultRetryBackoff
+	RetryBackoff time.Duration
+
+	// Timeout holds the timeout of a single push request, see DefaultTimeout for default
+	Timeout time.Duration
+
+	/*
+		DrainTimeout holds how long Close waits for queued profiles to be pushed, see DefaultDrainTimeout for default
+		When it expires, pushes in progress and their retries are abandoned, profiles still queued are dropped
+	*/
+	DrainTimeout time.Duration
+
+	// HTTPClient holds a custom client for pushes, Timeout is ignored when it is set
+	HTTPClient *http.Client
+
+	// Logger holds the logger failed pushes are logged to, if nil they are printed to stderr
+	Logger profile.StructuredLogger
+}
+
+// Stats holds the counters of an Exporter
+type Stats struct {
+	// Queued holds the number of profiles accepted in the queue
+	Queued uint64
+
+	// Sent holds the number of profiles pushed successfully
+	Sent uint64
+
+	// Failed holds the number of profiles not pushed after all retries
+	Failed uint64
+
+	// Dropped holds the number of profiles dropped because the queue was full, the exporter closed or its drain expired
+	Dropped uint64
+
+	// Skipped holds the number of artifacts skipped because they are not pprof profiles (trace, flight, metrics)
+	Skipped uint64
+}
+
+// push holds a profile waiting to be pushed
+type push struct {
+	mode   string
+	labels map[string]string
+	from   time.Time
+	until  time.Time
+	data   []byte
+}
+
+// Exporter pushes profiles to a continuous-profiling ingest server, it implements profile.Sink
+type Exporter struct {
+	serverURL     string
+	appName       string
+	labels        map[string]string
+	authToken     string
+	api           API
+	batchSize     int
+	batchInterval time.Duration
+	drainTimeout  time.Duration
+	retry         httpretry.Policy
+	client        *http.Client
+	logger        profile.StructuredLogger
+
+	// mu guards closed and sends to queue against Close
+	mu        sync.RWMutex
+	closed    bool
+	queue     chan push
+	stoppedCh chan struct{}
+
+	// ctx is cancelled when the drain of Close expires, abandoning pushes
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	queued  uint64
+	sent    uint64
+	failed  uint64
+	dropped uint64
+	skipped uint64
+}
+
+// New returns a new Exporter pushing to the server described by cfg, call Close to push queued profiles and stop it
+func New(cfg *Config) (*Exporter, error) {
+	if cfg.ServerURL == "" {
+		return nil, errors.New("ingest exporter server URL not set")
+	}
+	if cfg.ApplicationName == "" {
+		return nil, errors.New("ingest exporter application name not set")
+	}
+
+	exporter := &Exporter{
+		serverURL:     strings.TrimSuffix(cfg.ServerURL, "/"),
+		appName:       cfg.ApplicationName,
+		labels:        cfg.Labels,
+		authToken:     cfg.AuthToken,
+		api:           cfg.API,
+		batchSize:     cfg.BatchSize,
+		batchInterval: cfg.BatchInterval,
+		drainTimeout:  cfg.DrainTimeout,
+		retry:         httpretry.NewPolicy(cfg.MaxRetries, cfg.RetryBackoff, DefaultMaxRetries, DefaultRetryBackoff),
+		client:        cfg.HTTPClient,
+		logger:        cfg.Logger,
+		stoppedCh:     make(chan struct{}),
+	}
+	switch exporter.api {
+	case "":
+		exporter.api = IngestAPI
+	case IngestAPI, PushAPI:
+	default:
+		return nil, fmt.Errorf("ingest exporter API %q not supported", string(exporter.api))
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	exporter.queue = make(chan push, queueSize)
+	if exporter.api == IngestAPI {
+		// the ingest API takes a single profile per request
+		exporter.batchSize = 1
+	}
+	if exporter.batchSize <= 0 {
+		exporter.batchSize = DefaultBatchSize
+	}
+	if exporter.batchInterval <= 0 {
+		exporter.batchInterval = DefaultBatchInterval
+	}
+	if exporter.drainTimeout <= 0 {
+		exporter.drainTimeout = DefaultDrainTimeout
+	}
+	if exporter.client == nil {
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		exporter.client = &http.Client{Timeout: timeout}
+	}
+	if exporter.logger == nil {
+		exporter.logger = profile.FromStdLogger(log.New(os.Stderr, "", log.LstdFlags))
+	}
+
+	exporter.ctx, exporter.cancel = context.WithCancel(context.Background())
+	go exporter.run()
+	return exporter, nil
+}
+
+/*
+	Send queues the profile file of the artifact to be pushed, returning the URL it will be pushed to
+	The file is read immediately, so later sinks may delete it
+	Artifacts of modes not writing pprof profiles are skipped without error, so the exporter can be shared by all
+	profiles of the application
+*/
+func (e *Exporter) Send(artifact profile.Artifact) (profile.Delivery, error) {
+	if unsupportedModes[artifact.Mode] {
+		atomic.AddUint64(&e.skipped, 1)
+		return profile.Delivery{}, nil
+	}
+
+	data, err := ioutil.ReadFile(artifact.Path)
+	if err != nil {
+		return profile.Delivery{}, err
+	}
+	item := push{mode: artifact.Mode, labels: e.mergeLabels(artifact.Labels), from: artifact.StartTime,
+		until: artifact.StopTime, data: data}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.closed {
+		atomic.AddUint64(&e.dropped, 1)
+		return profile.Delivery{}, errors.New("ingest exporter closed, profile dropped")
+	}
+	select {
+	case e.queue <- item:
+		atomic.AddUint64(&e.queued, 1)
+		return profile.Delivery{Location: e.pushURL(item)}, nil
+	default:
+		atomic.AddUint64(&e.dropped, 1)
+		return profile.Delivery{}, errors.New("ingest exporter queue full, profile dropped")
+	}
+}
+
+/*
+	Close pushes all queued profiles and stops the exporter, profiles sent afterwards are dropped
+	It waits at most DrainTimeout, then abandons the pushes in progress and drops the profiles still queued
+*/
+func (e *Exporter) Close() {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mu.Unlock()
+
+	timer := time.NewTimer(e.drainTimeout)
+	defer timer.Stop()
+	select {
+	case <-e.stoppedCh:
+	case <-timer.C:
+		e.cancel()
+		<-e.stoppedCh
+	}
+	e.cancel()
+}
+
+// Stats returns the current counters of the exporter
+func (e *Exporter) Stats() Stats {
+	return Stats{
+		Queued:  atomic.LoadUint64(&e.queued),
+		Sent:    atomic.LoadUint64(&e.sent),
+		Failed:  atomic.LoadUint64(&e.failed),
+		Dropped: atomic.LoadUint64(&e.dropped),
+		Skipped: atomic.LoadUint64(&e.skipped),
+	}
+}
+
+// mergeLabels returns the static labels of the exporter overridden by the given profile labels
+func (e *Exporter) mergeLabels(profileLabels map[string]string) map[string]string {
+	labels := make(map[string]string, len(e.labels)+len(profileLabels))
+	for key, value := range e.labels {
+		labels[key] = value
+	}
+	for key, value := range profileLabels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// pushURL returns the URL the profile is pushed to
+func (e *Exporter) pushURL(item push) string {
+	if e.api == PushAPI {
+		return e.serverURL + pushPath
+	}
+	return e.ingestURL(item)
+}
+
+// ingestURL returns the IngestAPI URL the profile is pushed to
+func (e *Exporter) ingestURL(item push) string {
+	keys := sortedKeys(item.labels)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = sanitize(key) + "=" + sanitize(item.labels[key])
+	}
+
+	query := url.Values{}
+	query.Set("name", e.appName+"."+item.mode+"{"+strings.Join(pairs, ",")+"}")
+	query.Set("from", strconv.FormatInt(item.from.Unix(), 10))
+	query.Set("until", strconv.FormatInt(item.until.Unix(), 10))
+	query.Set("format", "pprof")
+	query.Set("spyName", "gospy")
+	return e.serverURL + "/ingest?" + query.Encode()
+}
+
+// sanitize replaces the characters reserved by the name format with underscores
+func sanitize(value string) string {
+	return strings.NewReplacer("{", "_", "}", "_", ",", "_", "=", "_").Replace(value)
+}
+
+// sortedKeys returns the keys of the map in ascending order
+func sortedKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// run pushes queued profiles in batches of up to batchSize, until the queue is closed and drained
+func (e *Exporter) run() {
+	defer close(e.stoppedCh)
+
+	batch := make([]push, 0, e.batchSize)
+	var timeout <-chan time.Time
+	for {
+		select {
+		case item, ok := <-e.queue:
+			if !ok {
+				e.deliver(batch)
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) < e.batchSize {
+				if timeout == nil {
+					timeout = time.After(e.batchInterval)
+				}
+				continue
+			}
+
+		case <-timeout:
+		}
+
+		e.deliver(batch)
+		batch = batch[:0]
+		timeout = nil
+	}
+}
+
+// deliver pushes the batch, with a single request if the API takes batches, updating counters and logging failures
+func (e *Exporter) deliver(batch []push) {
+	if len(batch) == 0 {
+		return
+	}
+	if e.ctx.Err() != nil {
+		// drain of Close expired
+		atomic.AddUint64(&e.dropped, uint64(len(batch)))
+		return
+	}
+
+	err := e.pushWithRetry(batch)
+	if err != nil {
+		atomic.AddUint64(&e.failed, uint64(len(batch)))
+		e.logger.Log(profile.LevelError, "ingest push failed", profile.Field{Key: "url", Value: e.pushURL(batch[0])},
+			profile.Field{Key: "profiles", Value: len(batch)}, profile.Field{Key: "error", Value: err.Error()})
+		return
+	}
+	atomic.AddUint64(&e.sent, uint64(len(batch)))
+}
+
+// pushWithRetry pushes the batch in a single request, retrying transient failures, returning the last error on failure
+func (e *Exporter) pushWithRetry(batch []push) error {
+	body, contentType, err := e.requestBody(batch)
+	if err != nil {
+		return err
+	}
+	location := e.pushURL(batch[0])
+
+	attempts, err := httpretry.Do(e.ctx, e.client, e.retry, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, location, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		if e.authToken != "" {
+			req.Header.Set("Authorization", "Bearer "+e.authToken)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed after %d attempts: %w", attempts, err)
+	}
+	return nil
+}
+
+// requestBody returns the body of the request pushing the batch and its content type, see the package doc
+func (e *Exporter) requestBody(batch []push) ([]byte, string, error) {
+	if e.api == IngestAPI {
+		return batch[0].data, "application/octet-stream", nil
+	}
+
+	request := pushRequest{Series: make([]pushSeries, len(batch))}
+	for i, item := range batch {
+		profileType, ok := pushProfileTypes[item.mode]
+		if !ok {
+			profileType = item.mode
+		}
+		labels := []pushLabel{{Name: "__name__", Value: profileType}, {Name: "service_name", Value: e.appName}}
+		for _, key := range sortedKeys(item.labels) {
+			labels = append(labels, pushLabel{Name: key, Value: item.labels[key]})
+		}
+		request.Series[i] = pushSeries{Labels: labels, Samples: []pushSample{{ID: sampleID(), RawProfile: item.data}}}
+	}
+	body, err := json.Marshal(request)
+	return body, "application/json", err
+}
+
+// sampleID returns a random ID identifying a pushed profile, so the server can detect duplicates of retries
+func sampleID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// pushRequest holds the JSON body of a PushAPI request
+type pushRequest struct {
+	Series []pushSeries `json:"series"`
+}
+
+// pushSeries holds the labels and profiles of a series of a PushAPI request
+type pushSeries struct {
+	Labels  []pushLabel  `json:"labels"`
+	Samples []pushSample `json:"samples"`
+}
+
+// pushLabel holds a label of a PushAPI series
+type pushLabel struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// pushSample holds a profile of a PushAPI series, RawProfile is base64 encoded by encoding/json
+type pushSample struct {
+	ID         string `json:"ID"`
+	RawProfile []byte `json:"rawProfile"`
+}
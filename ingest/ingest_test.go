@@ -0,0 +1,286 @@
+package ingest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+	"github.com/bygui86/multi-profile/v2/ingest"
+)
+
+func TestExporterPush(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*http.Request
+	var bodies [][]byte
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+	}))
+	defer server.Close()
+
+	exporter, err := ingest.New(&ingest.Config{
+		ServerURL:       server.URL,
+		ApplicationName: "api",
+		Labels:          map[string]string{"env": "prod"},
+		AuthToken:       "token",
+		RetryBackoff:    time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	profile.BlockProfile(&profile.Config{
+		Path:   dir,
+		Quiet:  true,
+		Labels: map[string]string{"region": "eu"},
+		Sinks:  []profile.Sink{exporter},
+	}).Start().Stop()
+	exporter.Close()
+
+	assert.Equal(t, ingest.Stats{Queued: 1, Sent: 1}, exporter.Stats())
+	if assert.Len(t, requests, 1) {
+		query := requests[0].URL.Query()
+		assert.Equal(t, "/ingest", requests[0].URL.Path)
+		assert.Equal(t, "api.block{env=prod,region=eu}", query.Get("name"))
+		assert.Equal(t, "pprof", query.Get("format"))
+		assert.NotEmpty(t, query.Get("from"))
+		assert.NotEmpty(t, query.Get("until"))
+		assert.Equal(t, "Bearer token", requests[0].Header.Get("Authorization"))
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "block.pprof"))
+		assert.NoError(t, err)
+		assert.Equal(t, data, bodies[0])
+	}
+}
+
+func TestExporterQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	exporter, err := ingest.New(&ingest.Config{ServerURL: server.URL, ApplicationName: "api", QueueSize: 1})
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "cpu.pprof")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("data"), 0644))
+	for i := 0; i < 3; i++ {
+		_, _ = exporter.Send(profile.Artifact{Mode: "cpu", Path: file})
+	}
+	close(release)
+	exporter.Close()
+
+	stats := exporter.Stats()
+	assert.True(t, stats.Dropped >= 1, "expected dropped profiles, got %+v", stats)
+	assert.Equal(t, uint64(3), stats.Queued+stats.Dropped)
+	assert.Equal(t, stats.Queued, stats.Sent)
+}
+
+func TestExporterUnsupportedMode(t *testing.T) {
+	exporter, err := ingest.New(&ingest.Config{ServerURL: "http://localhost:4040", ApplicationName: "api"})
+	assert.NoError(t, err)
+	defer exporter.Close()
+
+	_, err = exporter.Send(profile.Artifact{Mode: "trace", Path: "trace.out"})
+	assert.NoError(t, err)
+	assert.Equal(t, ingest.Stats{Skipped: 1}, exporter.Stats())
+}
+
+// recordingLogger records the messages it receives
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Log(level profile.Level, msg string, fields ...profile.Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf("%s %s %v", level, msg, fields))
+}
+
+func TestExporterPushFailureLogged(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	logger := &recordingLogger{}
+	exporter, err := ingest.New(&ingest.Config{ServerURL: server.URL, ApplicationName: "api", Logger: logger})
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "cpu.pprof")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("data"), 0644))
+	_, err = exporter.Send(profile.Artifact{Mode: "cpu", Path: file})
+	assert.NoError(t, err)
+	exporter.Close()
+
+	assert.Equal(t, ingest.Stats{Queued: 1, Failed: 1}, exporter.Stats())
+	if assert.Len(t, logger.messages, 1) {
+		assert.Contains(t, logger.messages[0], "error ingest push failed")
+		assert.Contains(t, logger.messages[0], "400 Bad Request")
+	}
+}
+
+// pushServer records the series of PushAPI requests
+type pushServer struct {
+	mu       sync.Mutex
+	requests [][]pushSeries
+}
+
+type pushSeries struct {
+	Labels []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"labels"`
+	Samples []struct {
+		ID         string `json:"ID"`
+		RawProfile []byte `json:"rawProfile"`
+	} `json:"samples"`
+}
+
+func (s *pushServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Series []pushSeries `json:"series"`
+	}
+	if r.URL.Path != "/push.v1.PusherService/Push" || r.Header.Get("Content-Type") != "application/json" ||
+		json.NewDecoder(r.Body).Decode(&request) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, request.Series)
+}
+
+func (s *pushServer) batches() [][]pushSeries {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]pushSeries(nil), s.requests...)
+}
+
+func TestExporterPushAPIBatches(t *testing.T) {
+	store := &pushServer{}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	exporter, err := ingest.New(&ingest.Config{
+		ServerURL:       server.URL,
+		ApplicationName: "api",
+		Labels:          map[string]string{"env": "prod"},
+		API:             ingest.PushAPI,
+		BatchSize:       2,
+		BatchInterval:   time.Hour,
+	})
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "cpu.pprof")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("data"), 0644))
+	for i := 0; i < 3; i++ {
+		delivery, err := exporter.Send(profile.Artifact{Mode: "cpu", Path: file})
+		assert.NoError(t, err)
+		assert.Equal(t, server.URL+"/push.v1.PusherService/Push", delivery.Location)
+	}
+	// the last profile waits for its batch to fill, Close pushes it
+	exporter.Close()
+
+	assert.Equal(t, ingest.Stats{Queued: 3, Sent: 3}, exporter.Stats())
+	batches := store.batches()
+	if assert.Len(t, batches, 2) && assert.Len(t, batches[0], 2) && assert.Len(t, batches[1], 1) {
+		series := batches[0][0]
+		labels := map[string]string{}
+		for _, label := range series.Labels {
+			labels[label.Name] = label.Value
+		}
+		assert.Equal(t, map[string]string{"__name__": "process_cpu", "service_name": "api", "env": "prod"}, labels)
+		if assert.Len(t, series.Samples, 1) {
+			assert.Equal(t, []byte("data"), series.Samples[0].RawProfile)
+			assert.NotEmpty(t, series.Samples[0].ID)
+		}
+	}
+}
+
+func TestExporterPushAPIBatchInterval(t *testing.T) {
+	store := &pushServer{}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	exporter, err := ingest.New(&ingest.Config{
+		ServerURL:       server.URL,
+		ApplicationName: "api",
+		API:             ingest.PushAPI,
+		BatchInterval:   10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer exporter.Close()
+
+	file := filepath.Join(t.TempDir(), "block.pprof")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("data"), 0644))
+	_, err = exporter.Send(profile.Artifact{Mode: "block", Path: file})
+	assert.NoError(t, err)
+
+	// a partial batch is pushed once BatchInterval expires, without waiting for Close
+	assert.Eventually(t, func() bool { return exporter.Stats().Sent == 1 }, time.Second, 5*time.Millisecond)
+	assert.Len(t, store.batches(), 1)
+}
+
+func TestExporterUnknownAPI(t *testing.T) {
+	_, err := ingest.New(&ingest.Config{ServerURL: "http://localhost:4040", ApplicationName: "api", API: "grpc"})
+	assert.Error(t, err)
+}
+
+func TestExporterDrainTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// an unreachable server, answering only when the client gives up
+		_, _ = ioutil.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	exporter, err := ingest.New(&ingest.Config{
+		ServerURL:       server.URL,
+		ApplicationName: "api",
+		Logger:          &recordingLogger{},
+		MaxRetries:      10,
+		RetryBackoff:    time.Minute,
+		DrainTimeout:    100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "cpu.pprof")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("data"), 0644))
+	for i := 0; i < ingest.DefaultQueueSize; i++ {
+		_, _ = exporter.Send(profile.Artifact{Mode: "cpu", Path: file})
+	}
+
+	start := time.Now()
+	exporter.Close()
+	assert.True(t, time.Since(start) < 2*time.Second, "Close took %s", time.Since(start))
+
+	stats := exporter.Stats()
+	assert.Zero(t, stats.Sent)
+	assert.True(t, stats.Dropped > 0, "expected dropped profiles, got %+v", stats)
+	assert.Equal(t, stats.Queued, stats.Failed+stats.Dropped)
+}
@@ -0,0 +1,104 @@
+/*
+	Package httpretry sends HTTP requests retrying transient failures, it is shared by the packages delivering
+	profiles and results over HTTP (s3sink, ingest, webhook).
+*/
+package httpretry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxErrorBody holds the maximum number of response body bytes reported in errors
+const maxErrorBody = 1024
+
+// Policy holds how failed requests are retried
+type Policy struct {
+	// MaxRetries holds the number of retries after the first attempt, 0 for none
+	MaxRetries int
+
+	// Backoff holds the wait before the first retry, doubled on every following retry
+	Backoff time.Duration
+}
+
+/*
+	NewPolicy returns the policy of the given configured values, zero values fall back to the given defaults and a
+	negative maxRetries disables retries, as documented by the Config of every delivery package
+*/
+func NewPolicy(maxRetries int, backoff time.Duration, defaultMaxRetries int, defaultBackoff time.Duration) Policy {
+	switch {
+	case maxRetries == 0:
+		maxRetries = defaultMaxRetries
+	case maxRetries < 0:
+		maxRetries = 0
+	}
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	return Policy{MaxRetries: maxRetries, Backoff: backoff}
+}
+
+// NewRequestFunc returns a new request bound to ctx, it is called on every attempt so the body can be read again
+type NewRequestFunc func(ctx context.Context) (*http.Request, error)
+
+/*
+	Do sends the request returned by newRequest until it gets a 2xx response, retrying network errors and
+	Retryable statuses as allowed by policy, and gives up when ctx is done
+	It returns the number of attempts made and the error of the last one
+*/
+func Do(ctx context.Context, client *http.Client, policy Policy, newRequest NewRequestFunc) (int, error) {
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := send(ctx, client, newRequest)
+		if err == nil {
+			return attempt, nil
+		}
+		if !retry || attempt > policy.MaxRetries || ctx.Err() != nil {
+			return attempt, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		}
+		backoff *= 2
+	}
+}
+
+// Retryable returns true if a response with the given status may succeed later (server errors and throttling)
+func Retryable(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// send makes a single attempt, returning whether its failure is transient
+func send(ctx context.Context, client *http.Client, newRequest NewRequestFunc) (bool, error) {
+	req, err := newRequest(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		return Retryable(resp.StatusCode), fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return Retryable(resp.StatusCode), fmt.Errorf("unexpected status %s: %s", resp.Status, message)
+}
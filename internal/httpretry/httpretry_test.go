@@ -0,0 +1,92 @@
+package httpretry_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2/internal/httpretry"
+)
+
+func newGet(url string) httpretry.NewRequestFunc {
+	return func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	}
+}
+
+func TestDoRetries(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	policy := httpretry.Policy{MaxRetries: 3, Backoff: time.Millisecond}
+	attempts, err := httpretry.Do(context.Background(), server.Client(), policy, newGet(server.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	// retries exhausted
+	mu.Lock()
+	calls = 0
+	mu.Unlock()
+	policy.MaxRetries = 1
+	attempts, err = httpretry.Do(context.Background(), server.Client(), policy, newGet(server.URL))
+	assert.Error(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestDoClientError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	policy := httpretry.Policy{MaxRetries: 3, Backoff: time.Millisecond}
+	attempts, err := httpretry.Do(context.Background(), server.Client(), policy, newGet(server.URL))
+	assert.EqualError(t, err, "unexpected status 404 Not Found: no such bucket")
+	assert.Equal(t, 1, attempts)
+}
+
+func TestDoContextDone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	policy := httpretry.Policy{MaxRetries: 10, Backoff: time.Hour}
+	start := time.Now()
+	attempts, err := httpretry.Do(ctx, server.Client(), policy, newGet(server.URL))
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, httpretry.Retryable(http.StatusInternalServerError))
+	assert.True(t, httpretry.Retryable(http.StatusTooManyRequests))
+	assert.False(t, httpretry.Retryable(http.StatusBadRequest))
+	assert.False(t, httpretry.Retryable(http.StatusForbidden))
+}
+
+func TestNewPolicy(t *testing.T) {
+	assert.Equal(t, httpretry.Policy{MaxRetries: 3, Backoff: time.Second},
+		httpretry.NewPolicy(0, 0, 3, time.Second))
+	assert.Equal(t, httpretry.Policy{MaxRetries: 5, Backoff: time.Millisecond},
+		httpretry.NewPolicy(5, time.Millisecond, 3, time.Second))
+	assert.Equal(t, httpretry.Policy{MaxRetries: 0, Backoff: time.Second},
+		httpretry.NewPolicy(-1, 0, 3, time.Second))
+}
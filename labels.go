@@ -0,0 +1,68 @@
+package profile
+
+import (
+	"context"
+	"net/http"
+	"runtime/pprof"
+)
+
+const (
+	// RouteLabel holds the pprof label key used by LabelHandler for the request route
+	RouteLabel = "http.route"
+
+	// MethodLabel holds the pprof label key used by LabelHandler for the request method
+	MethodLabel = "http.method"
+)
+
+// RouteFunc defines how LabelHandler extracts the route from a request
+type RouteFunc func(r *http.Request) string
+
+/*
+	Region runs fn with the given pprof label attached to the current goroutine,
+	so CPU and goroutine profiles can be sliced by code region (e.g. go tool pprof -tagfocus=handler=/users).
+	Labels already set in ctx are preserved and goroutines started by fn inherit the labels.
+*/
+func Region(ctx context.Context, key, value string, fn func(context.Context)) {
+	pprof.Do(ctx, pprof.Labels(key, value), fn)
+}
+
+/*
+	RegionLabels runs fn with the given pprof labels attached to the current goroutine.
+	Labels are provided as key-value pairs, see Region.
+*/
+func RegionLabels(ctx context.Context, fn func(context.Context), keyValues ...string) {
+	pprof.Do(ctx, pprof.Labels(keyValues...), fn)
+}
+
+/*
+	SetGoroutineLabels attaches the given pprof labels, provided as key-value pairs, to the current goroutine
+	and returns the labeled context. Unlike Region, labels stay set until replaced, so it fits long-lived goroutines.
+*/
+func SetGoroutineLabels(ctx context.Context, keyValues ...string) context.Context {
+	ctx = pprof.WithLabels(ctx, pprof.Labels(keyValues...))
+	pprof.SetGoroutineLabels(ctx)
+	return ctx
+}
+
+/*
+	LabelHandler wraps the given handler labeling each request by route and method (see RouteLabel and MethodLabel),
+	so CPU and goroutine profiles can be sliced per endpoint.
+	If routeFn is nil, the request URL path is used as route.
+*/
+func LabelHandler(next http.Handler, routeFn RouteFunc) http.Handler {
+	if routeFn == nil {
+		routeFn = urlPathRoute
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		labels := pprof.Labels(RouteLabel, routeFn(r), MethodLabel, r.Method)
+		pprof.Do(r.Context(), labels, func(ctx context.Context) {
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+}
+
+// urlPathRoute uses the request URL path as route
+func urlPathRoute(r *http.Request) string {
+	return r.URL.Path
+}
@@ -0,0 +1,37 @@
+package profile_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+func TestRegion(t *testing.T) {
+	called := false
+	profile.Region(context.Background(), "handler", "/users", func(ctx context.Context) {
+		called = true
+		value, ok := pprof.Label(ctx, "handler")
+		assert.True(t, ok)
+		assert.Equal(t, "/users", value)
+	})
+	assert.True(t, called)
+}
+
+func TestLabelHandler(t *testing.T) {
+	var route, method string
+	handler := profile.LabelHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, _ = pprof.Label(r.Context(), profile.RouteLabel)
+		method, _ = pprof.Label(r.Context(), profile.MethodLabel)
+	}), nil)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", nil))
+
+	assert.Equal(t, "/users", route)
+	assert.Equal(t, http.MethodPost, method)
+}
@@ -0,0 +1,232 @@
+package profile
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pprofile "github.com/google/pprof/profile"
+
+	"github.com/bygui86/multi-profile/v2/analysis"
+)
+
+// leakDetectionState holds goroutine leak detection configurations and state of a profile
+type leakDetectionState struct {
+	// interval holds the interval at which goroutine stacks are captured, in addition to Start and Stop
+	interval time.Duration
+
+	// mu protects the fields below, updated periodically by a separate goroutine
+	mu sync.Mutex
+
+	// snapshots holds the number of snapshots captured
+	snapshots int
+
+	// firstTime and lastTime hold the time of the first and last snapshot
+	firstTime time.Time
+	lastTime  time.Time
+
+	// signatures holds running goroutine counts by stack signature, so memory does not grow with the session length
+	signatures map[string]*signatureCounts
+
+	// doneCh is closed on Stop to terminate the periodic capture
+	doneCh chan struct{}
+
+	// stoppedCh is closed when the periodic capture terminated
+	stoppedCh chan struct{}
+}
+
+// signatureCounts holds the running goroutine counts of a stack signature across snapshots
+type signatureCounts struct {
+	// first and last hold the goroutine count in the first and last snapshot, 0 if absent
+	first int64
+	last  int64
+
+	// growing is true while the goroutine count never decreased from a snapshot to the next one
+	growing bool
+}
+
+// goroutineLeak describes a stack signature whose goroutine count kept growing
+type goroutineLeak struct {
+	signature string
+	first     int64
+	last      int64
+}
+
+// growth returns the difference between last and first goroutine count
+func (l *goroutineLeak) growth() int64 {
+	return l.last - l.first
+}
+
+// leakReportFileName returns the name of the leak report file related to the given profile file name
+func leakReportFileName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + "-leaks.txt"
+}
+
+// startLeakDetection captures the first goroutine snapshot and, if an interval is set, starts periodic captures
+func (p *Profile) startLeakDetection() {
+	if p.leaks == nil {
+		return
+	}
+
+	p.leaks.snapshots = 0
+	p.leaks.signatures = make(map[string]*signatureCounts)
+	p.captureGoroutines()
+
+	if p.leaks.interval > 0 {
+		p.leaks.doneCh = make(chan struct{})
+		p.leaks.stoppedCh = make(chan struct{})
+		go p.captureGoroutinesPeriodically(p.leaks.doneCh, p.leaks.stoppedCh)
+	}
+
+	p.logf(LevelInfo, "%s leak detection enabled, report file %s",
+		string(p.mode), filepath.Join(p.path, leakReportFileName(p.fileName)))
+}
+
+// stopLeakDetection stops periodic captures and captures the last goroutine snapshot
+func (p *Profile) stopLeakDetection() {
+	if p.leaks == nil {
+		return
+	}
+
+	if p.leaks.doneCh != nil {
+		close(p.leaks.doneCh)
+		<-p.leaks.stoppedCh
+		p.leaks.doneCh = nil
+	}
+	p.captureGoroutines()
+}
+
+// captureGoroutinesPeriodically captures goroutine snapshots at the configured interval, until doneCh is closed
+func (p *Profile) captureGoroutinesPeriodically(doneCh, stoppedCh chan struct{}) {
+	defer close(stoppedCh)
+
+	ticker := time.NewTicker(p.leaks.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.captureGoroutines()
+		case <-doneCh:
+			return
+		}
+	}
+}
+
+// captureGoroutines captures goroutine counts grouped by stack signature
+func (p *Profile) captureGoroutines() {
+	buf := &bytes.Buffer{}
+	err := pprof.Lookup("goroutine").WriteTo(buf, 0)
+	if err != nil {
+		p.logf(LevelError, "%s leak detection capture failed: %s", string(p.mode), err.Error())
+		return
+	}
+	prof, err := pprofile.Parse(buf)
+	if err != nil {
+		p.logf(LevelError, "%s leak detection capture failed: %s", string(p.mode), err.Error())
+		return
+	}
+
+	counts := make(map[string]int64)
+	for _, sample := range prof.Sample {
+		signature := strings.Join(analysis.StackFunctions(sample), "\n")
+		counts[signature] += sample.Value[0]
+	}
+
+	p.leaks.mu.Lock()
+	defer p.leaks.mu.Unlock()
+
+	now := time.Now()
+	if p.leaks.snapshots == 0 {
+		p.leaks.firstTime = now
+	}
+	p.leaks.lastTime = now
+	for signature, count := range counts {
+		if _, ok := p.leaks.signatures[signature]; !ok {
+			// absent from previous snapshots, counted as 0
+			p.leaks.signatures[signature] = &signatureCounts{growing: true}
+			if p.leaks.snapshots == 0 {
+				p.leaks.signatures[signature].first = count
+			}
+		}
+	}
+	for signature, running := range p.leaks.signatures {
+		count := counts[signature]
+		if count < running.last {
+			running.growing = false
+		}
+		running.last = count
+	}
+	p.leaks.snapshots++
+}
+
+// findLeaks returns stack signatures whose goroutine count never decreased and grew between first and last snapshot
+func (p *Profile) findLeaks() []*goroutineLeak {
+	p.leaks.mu.Lock()
+	defer p.leaks.mu.Unlock()
+
+	if p.leaks.snapshots < 2 {
+		return nil
+	}
+
+	var leaks []*goroutineLeak
+	for signature, running := range p.leaks.signatures {
+		leak := &goroutineLeak{signature: signature, first: running.first, last: running.last}
+		if running.growing && leak.growth() > 0 {
+			leaks = append(leaks, leak)
+		}
+	}
+
+	sort.Slice(leaks, func(i, j int) bool {
+		if leaks[i].growth() != leaks[j].growth() {
+			return leaks[i].growth() > leaks[j].growth()
+		}
+		return leaks[i].signature < leaks[j].signature
+	})
+	return leaks
+}
+
+// writeLeakReport writes the goroutine leak report next to the goroutine profile file, unless the session failed
+func (p *Profile) writeLeakReport() {
+	if p.leaks == nil || p.sessionErr() != nil {
+		return
+	}
+
+	leaks := p.findLeaks()
+	reportPath := filepath.Join(p.path, leakReportFileName(p.fileName))
+
+	builder := &strings.Builder{}
+	p.leaks.mu.Lock()
+	snapshots, firstTime, lastTime := p.leaks.snapshots, p.leaks.firstTime, p.leaks.lastTime
+	p.leaks.mu.Unlock()
+	if snapshots > 0 {
+		fmt.Fprintf(builder, "Goroutine leak report: %d snapshots from %s to %s\n",
+			snapshots, firstTime.Format(time.RFC3339), lastTime.Format(time.RFC3339))
+	}
+	fmt.Fprintf(builder, "Stack signatures whose goroutine count kept growing: %d\n", len(leaks))
+	for _, leak := range leaks {
+		fmt.Fprintf(builder, "\n+%d goroutines, counts: %d -> %d\n", leak.growth(), leak.first, leak.last)
+		for _, fn := range strings.Split(leak.signature, "\n") {
+			fmt.Fprintf(builder, "    %s\n", fn)
+		}
+	}
+
+	err := p.writeFile(reportPath, []byte(builder.String()))
+	if err != nil {
+		p.logf(LevelError, "%s leak report file %s creation failed: %s", string(p.mode), reportPath, err.Error())
+		return
+	}
+
+	if len(leaks) > 0 {
+		p.logf(LevelWarn, "%s leak detection found %d growing stack signatures, report written to file %s",
+			string(p.mode), len(leaks), reportPath)
+	} else {
+		p.logf(LevelInfo, "%s leak detection found no growing stack signature, report written to file %s",
+			string(p.mode), reportPath)
+	}
+}
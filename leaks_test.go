@@ -0,0 +1,88 @@
+package profile_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+//go:noinline
+func leakingWorker(blockCh chan struct{}) {
+	<-blockCh
+}
+
+func TestGoroutineLeakDetection(t *testing.T) {
+	dir := t.TempDir()
+	blockCh := make(chan struct{})
+	defer close(blockCh)
+
+	prof := profile.GoroutineProfile(&profile.Config{
+		Path:                   dir,
+		Quiet:                  true,
+		GoroutineLeakDetection: true,
+		GoroutineLeakInterval:  20 * time.Millisecond,
+	}).Start()
+	for i := 0; i < 5; i++ {
+		go leakingWorker(blockCh)
+		time.Sleep(10 * time.Millisecond)
+	}
+	prof.Stop()
+
+	report, err := ioutil.ReadFile(filepath.Join(dir, "goroutine-leaks.txt"))
+	checkErr(t, err)
+	assert.Contains(t, string(report), "+5 goroutines")
+	assert.Contains(t, string(report), "github.com/bygui86/multi-profile/v2_test.leakingWorker")
+	checkPprofFiles(t, []string{filepath.Join(dir, "goroutine.pprof")})
+}
+
+//go:noinline
+func releasedWorker(blockCh chan struct{}) {
+	<-blockCh
+}
+
+func TestGoroutineLeakDetectionReleased(t *testing.T) {
+	dir := t.TempDir()
+	blockCh := make(chan struct{})
+
+	prof := profile.GoroutineProfile(&profile.Config{
+		Path:                   dir,
+		Quiet:                  true,
+		GoroutineLeakDetection: true,
+		GoroutineLeakInterval:  10 * time.Millisecond,
+	}).Start()
+	for i := 0; i < 3; i++ {
+		go releasedWorker(blockCh)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(blockCh)
+	time.Sleep(50 * time.Millisecond)
+	prof.Stop()
+
+	report, err := ioutil.ReadFile(filepath.Join(dir, "goroutine-leaks.txt"))
+	checkErr(t, err)
+	assert.NotContains(t, string(report), "releasedWorker")
+}
+
+func TestGoroutineLeakDetectionFailedSession(t *testing.T) {
+	dir := t.TempDir()
+	// a directory in place of the profile file makes the flush fail
+	checkErr(t, os.Mkdir(filepath.Join(dir, "goroutine.pprof"), 0700))
+
+	var result profile.Result
+	profile.GoroutineProfile(&profile.Config{
+		Path:                   dir,
+		Quiet:                  true,
+		GoroutineLeakDetection: true,
+		GoroutineLeakInterval:  10 * time.Millisecond,
+		ResultHook:             func(r profile.Result) { result = r },
+	}).Start().Stop()
+
+	assert.Error(t, result.Err)
+	assert.NoFileExists(t, filepath.Join(dir, "goroutine-leaks.txt"))
+}
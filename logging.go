@@ -0,0 +1,123 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// levelRanks holds the order of logging levels, from the most to the least verbose
+var levelRanks = map[Level]int{
+	LevelDebug: 0,
+	LevelInfo:  1,
+	LevelWarn:  2,
+	LevelError: 3,
+}
+
+// enabled returns true if messages at the given level are logged with l as minimum level, blank logs all levels
+func (l Level) enabled(level Level) bool {
+	minimum, ok := levelRanks[l]
+	if !ok {
+		return true
+	}
+	return levelRanks[level] >= minimum
+}
+
+// Field holds a key-value pair attached to a log message
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// StructuredLogger defines the minimal interface of a structured logger, receiving level, message and key-value fields
+type StructuredLogger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+/*
+	newStructuredLogger returns the structured logger configured in cfg, adapting Logger if set
+	If none is set, messages are printed to LogWriter, or stderr if nil
+*/
+func newStructuredLogger(cfg *Config) StructuredLogger {
+	if cfg.StructuredLogger != nil {
+		return cfg.StructuredLogger
+	}
+	if cfg.Logger != nil {
+		return FromLogger(cfg.Logger)
+	}
+	writer := cfg.LogWriter
+	if writer == nil {
+		writer = os.Stderr
+	}
+	return defaultLogger{writer: writer}
+}
+
+// FromLogger adapts a printf-style Logger to StructuredLogger, fields are appended to the message as key=value
+func FromLogger(logger Logger) StructuredLogger {
+	return printfLogger{logger: logger}
+}
+
+// printfLogger adapts a printf-style Logger to StructuredLogger, the Fatal methods are never called
+type printfLogger struct {
+	logger Logger
+}
+
+func (l printfLogger) Log(level Level, msg string, fields ...Field) {
+	line := msg + formatFields(fields)
+	switch level {
+	case LevelDebug:
+		l.logger.Debugf("%s", line)
+	case LevelWarn:
+		l.logger.Warnf("%s", line)
+	case LevelError:
+		l.logger.Errorf("%s", line)
+	default:
+		l.logger.Infof("%s", line)
+	}
+}
+
+// FromStdLogger adapts a standard library logger to StructuredLogger, printing "[level] message key=value ..."
+func FromStdLogger(logger *log.Logger) StructuredLogger {
+	return stdLogger{logger: logger}
+}
+
+// stdLogger adapts a standard library logger to StructuredLogger
+type stdLogger struct {
+	logger *log.Logger
+}
+
+func (l stdLogger) Log(level Level, msg string, fields ...Field) {
+	l.logger.Printf("[%s] %s%s", level, msg, formatFields(fields))
+}
+
+// defaultLogWriterMu serializes the writes of all default loggers, profiles running together share the same writer
+var defaultLogWriterMu sync.Mutex
+
+// defaultLogger prints "[level] message key=value ..." to a writer, it is used when no logger is configured
+type defaultLogger struct {
+	writer io.Writer
+}
+
+func (l defaultLogger) Log(level Level, msg string, fields ...Field) {
+	line := fmt.Sprintf("[%s] %s%s\n", level, msg, formatFields(fields))
+
+	defaultLogWriterMu.Lock()
+	defer defaultLogWriterMu.Unlock()
+	_, _ = io.WriteString(l.writer, line)
+}
+
+// formatFields formats fields as " key=value" pairs, quoting values containing spaces
+func formatFields(fields []Field) string {
+	var builder strings.Builder
+	for _, field := range fields {
+		value := fmt.Sprint(field.Value)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		builder.WriteString(" " + field.Key + "=" + value)
+	}
+	return builder.String()
+}
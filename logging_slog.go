@@ -0,0 +1,42 @@
+//go:build go1.21
+// +build go1.21
+
+package profile
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// FromSlogHandler adapts a log/slog handler to StructuredLogger, for example FromSlogHandler(slog.Default().Handler())
+func FromSlogHandler(handler slog.Handler) StructuredLogger {
+	return slogLogger{handler: handler}
+}
+
+// slogLogger adapts a log/slog handler to StructuredLogger
+type slogLogger struct {
+	handler slog.Handler
+}
+
+func (l slogLogger) Log(level Level, msg string, fields ...Field) {
+	ctx := context.Background()
+	slogLevel := slogLevels[level]
+	if !l.handler.Enabled(ctx, slogLevel) {
+		return
+	}
+
+	record := slog.NewRecord(time.Now(), slogLevel, msg, 0)
+	for _, field := range fields {
+		record.AddAttrs(slog.Any(field.Key, field.Value))
+	}
+	_ = l.handler.Handle(ctx, record)
+}
+
+// slogLevels maps levels to log/slog levels
+var slogLevels = map[Level]slog.Level{
+	LevelDebug: slog.LevelDebug,
+	LevelInfo:  slog.LevelInfo,
+	LevelWarn:  slog.LevelWarn,
+	LevelError: slog.LevelError,
+}
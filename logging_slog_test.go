@@ -0,0 +1,26 @@
+//go:build go1.21
+// +build go1.21
+
+package profile_test
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+func TestFromSlogHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	handler := slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelWarn})
+	logger := profile.FromSlogHandler(handler)
+
+	logger.Log(profile.LevelInfo, "profiling enabled", profile.Field{Key: "mode", Value: "cpu"})
+	assert.Empty(t, buf.String())
+
+	logger.Log(profile.LevelError, "flush failed", profile.Field{Key: "mode", Value: "cpu"}, profile.Field{Key: "bytes", Value: 42})
+	assert.Contains(t, buf.String(), `level=ERROR msg="flush failed" mode=cpu bytes=42`)
+}
@@ -0,0 +1,164 @@
+package profile_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+// record holds a message received by recordingLogger
+type record struct {
+	level  profile.Level
+	msg    string
+	fields map[string]interface{}
+}
+
+// recordingLogger records all messages it receives
+type recordingLogger struct {
+	records []record
+}
+
+func (l *recordingLogger) Log(level profile.Level, msg string, fields ...profile.Field) {
+	values := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		values[field.Key] = field.Value
+	}
+	l.records = append(l.records, record{level: level, msg: msg, fields: values})
+}
+
+// printfLogger records the messages of a printf-style Logger
+type printfLogger struct {
+	lines []string
+}
+
+func (l *printfLogger) Debug(args ...interface{}) {
+	l.lines = append(l.lines, "debug "+fmt.Sprint(args...))
+}
+
+func (l *printfLogger) Info(args ...interface{}) {
+	l.lines = append(l.lines, "info "+fmt.Sprint(args...))
+}
+
+func (l *printfLogger) Warn(args ...interface{}) {
+	l.lines = append(l.lines, "warn "+fmt.Sprint(args...))
+}
+
+func (l *printfLogger) Error(args ...interface{}) {
+	l.lines = append(l.lines, "error "+fmt.Sprint(args...))
+}
+
+func (l *printfLogger) Fatal(args ...interface{}) {
+	l.lines = append(l.lines, "fatal "+fmt.Sprint(args...))
+}
+
+func (l *printfLogger) Debugf(t string, args ...interface{}) {
+	l.lines = append(l.lines, "debug "+fmt.Sprintf(t, args...))
+}
+
+func (l *printfLogger) Infof(t string, args ...interface{}) {
+	l.lines = append(l.lines, "info "+fmt.Sprintf(t, args...))
+}
+
+func (l *printfLogger) Warnf(t string, args ...interface{}) {
+	l.lines = append(l.lines, "warn "+fmt.Sprintf(t, args...))
+}
+
+func (l *printfLogger) Errorf(t string, args ...interface{}) {
+	l.lines = append(l.lines, "error "+fmt.Sprintf(t, args...))
+}
+
+func (l *printfLogger) Fatalf(t string, args ...interface{}) {
+	l.lines = append(l.lines, "fatal "+fmt.Sprintf(t, args...))
+}
+
+func TestStructuredLogger(t *testing.T) {
+	dir := t.TempDir()
+	logger := &recordingLogger{}
+	profile.BlockProfile(&profile.Config{Path: dir, StructuredLogger: logger, Logger: &printfLogger{}}).Start().Stop()
+
+	if assert.NotEmpty(t, logger.records) {
+		assert.Equal(t, profile.LevelInfo, logger.records[0].level)
+		assert.Contains(t, logger.records[0].msg, "Block profiling enabled")
+	}
+	var flushed *record
+	for i, r := range logger.records {
+		assert.Equal(t, "block", r.fields["mode"])
+		if strings.HasSuffix(r.msg, "profiling flushed") {
+			flushed = &logger.records[i]
+		}
+	}
+	if assert.NotNil(t, flushed) {
+		assert.Equal(t, profile.LevelDebug, flushed.level)
+		assert.Equal(t, filepath.Join(dir, "block.pprof"), flushed.fields["path"])
+		assert.True(t, flushed.fields["bytes"].(int64) > 0)
+	}
+}
+
+func TestFromLogger(t *testing.T) {
+	logger := &printfLogger{}
+	profile.FromLogger(logger).Log(profile.LevelWarn, "file written", profile.Field{Key: "path", Value: "a b.pprof"})
+	assert.Equal(t, []string{`warn file written path="a b.pprof"`}, logger.lines)
+
+	profile.BlockProfile(&profile.Config{Path: t.TempDir(), Logger: logger}).Start().Stop()
+	assert.Contains(t, logger.lines[1], "info Block profiling enabled")
+	assert.Contains(t, logger.lines[1], "mode=block")
+}
+
+func TestFromStdLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := profile.FromStdLogger(log.New(buf, "", 0))
+	logger.Log(profile.LevelError, "flush failed", profile.Field{Key: "mode", Value: "cpu"}, profile.Field{Key: "bytes", Value: 0})
+	assert.Equal(t, "[error] flush failed mode=cpu bytes=0\n", buf.String())
+}
+
+func TestLogWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	profile.BlockProfile(&profile.Config{Path: t.TempDir(), LogWriter: buf}).Start().Stop()
+	assert.Contains(t, buf.String(), "[info] Block profiling enabled")
+	assert.Contains(t, buf.String(), "[debug] Block profiling flushed mode=block")
+}
+
+func TestLogWriterShared(t *testing.T) {
+	buf := &bytes.Buffer{}
+	modes := []func(*profile.Config) *profile.Profile{
+		profile.BlockProfile, profile.MutexProfile, profile.GoroutineProfile, profile.ThreadCreationProfile,
+	}
+
+	// profiles running together write to the same writer, run with -race to catch unsynchronized writes
+	var wg sync.WaitGroup
+	for _, mode := range modes {
+		wg.Add(1)
+		go func(mode func(*profile.Config) *profile.Profile) {
+			defer wg.Done()
+			mode(&profile.Config{Path: t.TempDir(), LogWriter: buf}).Start().Stop()
+		}(mode)
+	}
+	wg.Wait()
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		assert.True(t, strings.HasPrefix(line, "["), line)
+	}
+	assert.Equal(t, len(modes), strings.Count(buf.String(), "profiling enabled"))
+}
+
+func TestLogLevel(t *testing.T) {
+	logger := &recordingLogger{}
+	profile.BlockProfile(&profile.Config{Path: t.TempDir(), StructuredLogger: logger, LogLevel: profile.LevelInfo}).Start().Stop()
+
+	assert.NotEmpty(t, logger.records)
+	for _, r := range logger.records {
+		assert.NotEqual(t, profile.LevelDebug, r.level)
+	}
+
+	buf := &bytes.Buffer{}
+	profile.BlockProfile(&profile.Config{Path: t.TempDir(), LogWriter: buf, LogLevel: profile.LevelWarn}).Start().Stop()
+	assert.Empty(t, buf.String())
+}
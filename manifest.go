@@ -0,0 +1,151 @@
+package profile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Manifest describes a flushed profile, it is written as JSON sidecar file next to the profile file
+type Manifest struct {
+	// Mode holds the profiling mode (CPU, Memory, Mutex, etc)
+	Mode string `json:"mode"`
+
+	// File holds the path to the profile file the manifest refers to
+	File string `json:"file"`
+
+	// MemProfileType holds the memory profile type, only for Memory mode
+	MemProfileType string `json:"memProfileType,omitempty"`
+
+	// MemProfileRate holds the memory profile rate, only for Memory mode
+	MemProfileRate int `json:"memProfileRate,omitempty"`
+
+	// StartTime holds the time at which the profiling session started
+	StartTime time.Time `json:"startTime"`
+
+	// StopTime holds the time at which the profiling session stopped
+	StopTime time.Time `json:"stopTime"`
+
+	// DurationSeconds holds the duration of the profiling session
+	DurationSeconds float64 `json:"durationSeconds"`
+
+	// Hostname holds the name of the host running the profiled application
+	Hostname string `json:"hostname"`
+
+	// PID holds the process ID of the profiled application
+	PID int `json:"pid"`
+
+	// GoVersion holds the Go version the profiled application was built with
+	GoVersion string `json:"goVersion"`
+
+	// GOOS holds the operating system target of the profiled application
+	GOOS string `json:"goos"`
+
+	// GOARCH holds the architecture target of the profiled application
+	GOARCH string `json:"goarch"`
+
+	// Module holds the main module of the profiled application, if build info are available
+	Module *ModuleVersion `json:"module,omitempty"`
+
+	// Dependencies holds the dependency modules of the profiled application, if build info are available
+	Dependencies []ModuleVersion `json:"dependencies,omitempty"`
+
+	// VCS holds the version control information stamped into the binary, if available
+	VCS *VCSInfo `json:"vcs,omitempty"`
+
+	// Labels holds the user-supplied labels from Config
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ModuleVersion describes a Go module linked into the profiled application
+type ModuleVersion struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Sum     string `json:"sum,omitempty"`
+}
+
+// VCSInfo describes the version control state the profiled application was built from
+type VCSInfo struct {
+	System   string `json:"system,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	Time     string `json:"time,omitempty"`
+	Modified bool   `json:"modified,omitempty"`
+}
+
+// manifestFileName returns the name of the manifest file related to the given profile file name
+func manifestFileName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".manifest.json"
+}
+
+// buildManifest collects all information describing the current profiling session
+func (p *Profile) buildManifest() *Manifest {
+	manifest := &Manifest{
+		Mode:            string(p.mode),
+		File:            p.filePath,
+		StartTime:       p.startTime,
+		StopTime:        p.stopTime,
+		DurationSeconds: p.stopTime.Sub(p.startTime).Seconds(),
+		PID:             os.Getpid(),
+		GoVersion:       runtime.Version(),
+		GOOS:            runtime.GOOS,
+		GOARCH:          runtime.GOARCH,
+		Labels:          p.labels,
+	}
+
+	if p.mode == memMode {
+		manifest.MemProfileType = string(p.memProfileType)
+		manifest.MemProfileRate = p.memProfileRate
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		p.logf(LevelWarn, "%s profiling manifest could not retrieve hostname: %s", string(p.mode), err.Error())
+	}
+	manifest.Hostname = hostname
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if ok {
+		manifest.Module = &ModuleVersion{
+			Path:    buildInfo.Main.Path,
+			Version: buildInfo.Main.Version,
+			Sum:     buildInfo.Main.Sum,
+		}
+		for _, dep := range buildInfo.Deps {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			manifest.Dependencies = append(manifest.Dependencies, ModuleVersion{
+				Path:    dep.Path,
+				Version: dep.Version,
+				Sum:     dep.Sum,
+			})
+		}
+		manifest.VCS = readVCSInfo(buildInfo)
+	}
+
+	return manifest
+}
+
+// writeManifest writes the manifest of the current profiling session next to the profile file
+func (p *Profile) writeManifest() {
+	manifestPath := filepath.Join(p.path, manifestFileName(p.fileName))
+
+	data, err := json.MarshalIndent(p.buildManifest(), "", "  ")
+	if err != nil {
+		p.logf(LevelError, "%s profiling manifest encoding failed: %s", string(p.mode), err.Error())
+		return
+	}
+
+	err = p.writeFile(manifestPath, data)
+	if err != nil {
+		p.logf(LevelError, "%s profiling manifest file %s creation failed: %s",
+			string(p.mode), manifestPath, err.Error())
+		return
+	}
+
+	p.logf(LevelInfo, "%s profiling manifest written to file %s", string(p.mode), manifestPath)
+}
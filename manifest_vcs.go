@@ -0,0 +1,30 @@
+//go:build go1.18
+// +build go1.18
+
+package profile
+
+import (
+	"runtime/debug"
+)
+
+// readVCSInfo extracts version control information stamped by the Go toolchain into the binary
+func readVCSInfo(buildInfo *debug.BuildInfo) *VCSInfo {
+	vcs := &VCSInfo{}
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs":
+			vcs.System = setting.Value
+		case "vcs.revision":
+			vcs.Revision = setting.Value
+		case "vcs.time":
+			vcs.Time = setting.Value
+		case "vcs.modified":
+			vcs.Modified = setting.Value == "true"
+		}
+	}
+
+	if vcs.System == "" && vcs.Revision == "" {
+		return nil
+	}
+	return vcs
+}
@@ -0,0 +1,13 @@
+//go:build !go1.18
+// +build !go1.18
+
+package profile
+
+import (
+	"runtime/debug"
+)
+
+// readVCSInfo returns nil, version control information are stamped into binaries only since Go 1.18
+func readVCSInfo(_ *debug.BuildInfo) *VCSInfo {
+	return nil
+}
@@ -0,0 +1,75 @@
+package profile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// embedFileMetadata rewrites the profile file adding labels and comments, so they survive when the file is copied around
+func (p *Profile) embedFileMetadata() {
+	if !p.writesPprof() {
+		p.logf(LevelWarn, "%s profiling does not support embedded metadata, skipping", string(p.mode))
+		return
+	}
+	if len(p.labels) == 0 && len(p.comments) == 0 {
+		return
+	}
+
+	prof, err := readProfileFile(p.filePath)
+	if err != nil {
+		p.logf(LevelError, "%s profiling metadata embedding failed, could not read file %s: %s",
+			string(p.mode), p.filePath, err.Error())
+		return
+	}
+
+	addMetadata(prof, p.labels, p.comments)
+
+	err = p.writeProfileFile(p.filePath, prof)
+	if err != nil {
+		p.logf(LevelError, "%s profiling metadata embedding failed, could not write file %s: %s",
+			string(p.mode), p.filePath, err.Error())
+		return
+	}
+
+	p.logf(LevelInfo, "%s profiling metadata embedded into file %s", string(p.mode), p.filePath)
+}
+
+// addMetadata adds labels as comments and as string labels of every sample, then adds custom comments
+func addMetadata(prof *pprofile.Profile, labels map[string]string, comments []string) {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		prof.Comments = append(prof.Comments, fmt.Sprintf("%s=%s", key, labels[key]))
+		prof.SetLabel(key, []string{labels[key]})
+	}
+	prof.Comments = append(prof.Comments, comments...)
+}
+
+// readProfileFile reads and parses the pprof file at the given path
+func readProfileFile(path string) (*pprofile.Profile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return pprofile.Parse(file)
+}
+
+// writeProfileFile writes the given profile, gzip compressed, to the file at the given path, see writeFile
+func (p *Profile) writeProfileFile(path string, prof *pprofile.Profile) error {
+	var buf bytes.Buffer
+	err := prof.Write(&buf)
+	if err != nil {
+		return err
+	}
+	return p.writeFile(path, buf.Bytes())
+}
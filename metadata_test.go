@@ -0,0 +1,56 @@
+package profile_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	pprofile "github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+func TestEmbedMetadata(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &profile.Config{
+		Path:          dir,
+		Quiet:         true,
+		EmbedMetadata: true,
+		Labels:        map[string]string{"service": "test-svc", "environment": "test"},
+		Comments:      []string{"custom comment"},
+	}
+	profile.MemProfile(cfg).Start().Stop()
+
+	file, err := os.Open(filepath.Join(dir, "mem.pprof"))
+	checkErr(t, err)
+	defer file.Close()
+	prof, err := pprofile.Parse(file)
+	checkErr(t, err)
+
+	assert.Equal(t, []string{"environment=test", "service=test-svc", "custom comment"}, prof.Comments)
+	for _, sample := range prof.Sample {
+		assert.Equal(t, []string{"test-svc"}, sample.Label["service"])
+		assert.Equal(t, []string{"test"}, sample.Label["environment"])
+	}
+}
+
+func TestEmbedMetadataSize(t *testing.T) {
+	dir := t.TempDir()
+	var result profile.Result
+	before := profile.ReadSelfMetrics().Modes["mem"]
+	profile.MemProfile(&profile.Config{
+		Path:          dir,
+		Quiet:         true,
+		EmbedMetadata: true,
+		Labels:        map[string]string{"service": "test-svc"},
+		ResultHook:    func(r profile.Result) { result = r },
+	}).Start().Stop()
+	after := profile.ReadSelfMetrics().Modes["mem"]
+
+	// size is measured on the rewritten file, not on the one written before embedding metadata
+	info, err := os.Stat(filepath.Join(dir, "mem.pprof"))
+	checkErr(t, err)
+	assert.Equal(t, info.Size(), result.Size)
+	assert.Equal(t, uint64(info.Size()), after.BytesWritten-before.BytesWritten)
+}
@@ -0,0 +1,239 @@
+package profile
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultMetricsInterval holds the default interval at which runtime metrics are sampled
+	DefaultMetricsInterval = time.Second
+
+	// DefaultMetricsFormat holds the default format of the runtime metrics timeseries file
+	DefaultMetricsFormat = MetricsFormatJSONLines
+
+	// Supported runtime metrics timeseries formats
+	MetricsFormatJSONLines MetricsFormat = "jsonl"
+	MetricsFormatCSV       MetricsFormat = "csv"
+)
+
+// MetricsFormat defines the format of the runtime metrics timeseries file
+type MetricsFormat string
+
+// metricsState holds runtime metrics sampling configurations and state of a profile
+type metricsState struct {
+	interval time.Duration
+	format   MetricsFormat
+
+	// writer buffers the writes to the timeseries file
+	writer *bufio.Writer
+
+	// csvWriter writes CSV records to writer, only for CSV format
+	csvWriter *csv.Writer
+
+	// columns holds the CSV columns, set by the first sample, only for CSV format
+	columns []string
+
+	// doneCh is closed on Stop to terminate the periodic sampling
+	doneCh chan struct{}
+
+	// stoppedCh is closed when the periodic sampling terminated
+	stoppedCh chan struct{}
+}
+
+// metricValue holds the value of a single runtime metric
+type metricValue struct {
+	name  string
+	value interface{}
+}
+
+/*
+	MetricsProfile creates a runtime metrics recording object: runtime.ReadMemStats and runtime/metrics
+	(since Go 1.16) are sampled at MetricsInterval during the session and written as timeseries file
+*/
+func MetricsProfile(cfg *Config) *Profile {
+	format := DefaultMetricsFormat
+	if cfg.MetricsFormat != "" {
+		format = cfg.MetricsFormat
+	}
+	interval := DefaultMetricsInterval
+	if cfg.MetricsInterval > 0 {
+		interval = cfg.MetricsInterval
+	}
+
+	// INFO: lookupName not required
+	metricsPprof := buildProfile(metricsMode, "", "metrics."+string(format), cfg)
+	metricsPprof.metrics = &metricsState{interval: interval, format: format}
+	return metricsPprof
+}
+
+// startMetricsMode starts runtime metrics sampling
+func (p *Profile) startMetricsMode() {
+	if p.metrics.format != MetricsFormatJSONLines && p.metrics.format != MetricsFormatCSV {
+		p.failf("%s profiling start failed: unknown format %q", string(p.mode), p.metrics.format)
+		return
+	}
+
+	p.createFile()
+	if p.file == nil {
+		return
+	}
+
+	p.metrics.writer = bufio.NewWriter(p.file)
+	if p.metrics.format == MetricsFormatCSV {
+		p.metrics.csvWriter = csv.NewWriter(p.metrics.writer)
+		p.metrics.columns = nil
+	}
+	p.writeMetricsSample()
+
+	p.metrics.doneCh = make(chan struct{})
+	p.metrics.stoppedCh = make(chan struct{})
+	go p.sampleMetricsPeriodically(p.metrics.doneCh, p.metrics.stoppedCh)
+
+	p.internalCloser = p.stopMetricsMode
+
+	p.logf(LevelInfo, "%s profiling enabled at interval %s, file %s",
+		string(p.mode), p.metrics.interval.String(), p.filePath)
+}
+
+// stopMetricsMode stops runtime metrics sampling, writing a last sample and flushing the file
+func (p *Profile) stopMetricsMode() {
+	p.logf(LevelInfo, "Stop and flush %s profiling to file %s", string(p.mode), p.filePath)
+
+	close(p.metrics.doneCh)
+	<-p.metrics.stoppedCh
+	p.writeMetricsSample()
+
+	if p.metrics.csvWriter != nil {
+		p.metrics.csvWriter.Flush()
+	}
+	err := p.metrics.writer.Flush()
+	if err != nil {
+		p.failf("%s profiling flushing data to file %s failed: %s", string(p.mode), p.filePath, err.Error())
+	}
+	err = p.closeFile()
+	if err != nil {
+		p.failf("%s profiling flushing data to file %s failed: %s", string(p.mode), p.filePath, err.Error())
+	}
+
+	p.logf(LevelInfo, "%s profiling disabled", string(p.mode))
+}
+
+// sampleMetricsPeriodically writes a runtime metrics sample at the configured interval, until doneCh is closed
+func (p *Profile) sampleMetricsPeriodically(doneCh, stoppedCh chan struct{}) {
+	defer close(stoppedCh)
+
+	ticker := time.NewTicker(p.metrics.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.writeMetricsSample()
+		case <-doneCh:
+			return
+		}
+	}
+}
+
+// writeMetricsSample reads runtime metrics and writes them as a new line of the timeseries file
+func (p *Profile) writeMetricsSample() {
+	values := append([]metricValue{{name: "time", value: time.Now().Format(time.RFC3339Nano)}}, readMemStats()...)
+	values = append(values, readRuntimeMetrics()...)
+
+	var err error
+	switch p.metrics.format {
+	case MetricsFormatJSONLines:
+		err = p.writeMetricsJSONLine(values)
+	case MetricsFormatCSV:
+		err = p.writeMetricsCSVRecord(values)
+	}
+	if err != nil {
+		p.failf("%s profiling writing sample to file %s failed: %s",
+			string(p.mode), p.filePath, err.Error())
+	}
+}
+
+// writeMetricsJSONLine writes the sample as JSON object on a single line
+func (p *Profile) writeMetricsJSONLine(values []metricValue) error {
+	record := make(map[string]interface{}, len(values))
+	for _, value := range values {
+		record[value.name] = value.value
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = p.metrics.writer.Write(append(data, '\n'))
+	return err
+}
+
+// writeMetricsCSVRecord writes the sample as CSV record, columns are set by the first sample and written as header
+func (p *Profile) writeMetricsCSVRecord(values []metricValue) error {
+	byName := make(map[string]string, len(values))
+	for _, value := range values {
+		byName[value.name] = formatMetricValue(value.value)
+	}
+
+	if p.metrics.columns == nil {
+		for _, value := range values {
+			p.metrics.columns = append(p.metrics.columns, value.name)
+		}
+		err := p.metrics.csvWriter.Write(p.metrics.columns)
+		if err != nil {
+			return err
+		}
+	}
+
+	record := make([]string, 0, len(p.metrics.columns))
+	for _, column := range p.metrics.columns {
+		record = append(record, byName[column])
+	}
+	return p.metrics.csvWriter.Write(record)
+}
+
+// formatMetricValue formats a metric value for CSV records
+func formatMetricValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// readMemStats reads the main runtime.MemStats values and the number of goroutines
+func readMemStats() []metricValue {
+	stats := &runtime.MemStats{}
+	runtime.ReadMemStats(stats)
+
+	return []metricValue{
+		{name: "goroutines", value: runtime.NumGoroutine()},
+		{name: "memstats.alloc", value: stats.Alloc},
+		{name: "memstats.total_alloc", value: stats.TotalAlloc},
+		{name: "memstats.sys", value: stats.Sys},
+		{name: "memstats.mallocs", value: stats.Mallocs},
+		{name: "memstats.frees", value: stats.Frees},
+		{name: "memstats.heap_alloc", value: stats.HeapAlloc},
+		{name: "memstats.heap_sys", value: stats.HeapSys},
+		{name: "memstats.heap_idle", value: stats.HeapIdle},
+		{name: "memstats.heap_inuse", value: stats.HeapInuse},
+		{name: "memstats.heap_released", value: stats.HeapReleased},
+		{name: "memstats.heap_objects", value: stats.HeapObjects},
+		{name: "memstats.stack_inuse", value: stats.StackInuse},
+		{name: "memstats.next_gc", value: stats.NextGC},
+		{name: "memstats.num_gc", value: uint64(stats.NumGC)},
+		{name: "memstats.pause_total_ns", value: stats.PauseTotalNs},
+		{name: "memstats.gc_cpu_fraction", value: stats.GCCPUFraction},
+	}
+}
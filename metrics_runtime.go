@@ -0,0 +1,36 @@
+//go:build go1.16
+// +build go1.16
+
+package profile
+
+import (
+	"math"
+	"runtime/metrics"
+)
+
+// readRuntimeMetrics reads all scalar runtime/metrics values, histograms and non-finite values are skipped
+func readRuntimeMetrics() []metricValue {
+	descriptions := metrics.All()
+	samples := make([]metrics.Sample, 0, len(descriptions))
+	for _, description := range descriptions {
+		if description.Kind == metrics.KindUint64 || description.Kind == metrics.KindFloat64 {
+			samples = append(samples, metrics.Sample{Name: description.Name})
+		}
+	}
+	metrics.Read(samples)
+
+	values := make([]metricValue, 0, len(samples))
+	for _, sample := range samples {
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			values = append(values, metricValue{name: sample.Name, value: sample.Value.Uint64()})
+		case metrics.KindFloat64:
+			value := sample.Value.Float64()
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+			values = append(values, metricValue{name: sample.Name, value: value})
+		}
+	}
+	return values
+}
@@ -0,0 +1,9 @@
+//go:build !go1.16
+// +build !go1.16
+
+package profile
+
+// readRuntimeMetrics returns no value, runtime/metrics is available only since Go 1.16
+func readRuntimeMetrics() []metricValue {
+	return nil
+}
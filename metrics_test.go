@@ -0,0 +1,51 @@
+package profile_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+func TestMetricsProfileJSONLines(t *testing.T) {
+	dir := t.TempDir()
+	prof := profile.MetricsProfile(&profile.Config{Path: dir, Quiet: true, MetricsInterval: 10 * time.Millisecond}).Start()
+	time.Sleep(50 * time.Millisecond)
+	prof.Stop()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "metrics.jsonl"))
+	checkErr(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.True(t, len(lines) >= 3, "expected at least 3 samples, got %d", len(lines))
+	for _, line := range lines {
+		sample := make(map[string]interface{})
+		checkErr(t, json.Unmarshal([]byte(line), &sample))
+		assert.Contains(t, sample, "time")
+		assert.Contains(t, sample, "memstats.heap_alloc")
+		assert.Contains(t, sample, "goroutines")
+	}
+}
+
+func TestMetricsProfileCSV(t *testing.T) {
+	dir := t.TempDir()
+	prof := profile.MetricsProfile(&profile.Config{Path: dir, Quiet: true, MetricsFormat: profile.MetricsFormatCSV}).Start()
+	prof.Stop()
+
+	file, err := os.Open(filepath.Join(dir, "metrics.csv"))
+	checkErr(t, err)
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	checkErr(t, err)
+
+	assert.Len(t, records, 3)
+	assert.Equal(t, "time", records[0][0])
+	assert.Contains(t, records[0], "memstats.num_gc")
+}
@@ -3,6 +3,7 @@ package profile
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/signal"
@@ -10,8 +11,10 @@ import (
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
+	"sync"
 	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 const (
@@ -23,10 +26,18 @@ const (
 	traceMode     profileMode = "Trace"
 	threadMode    profileMode = "Thread"
 	goroutineMode profileMode = "Goroutine"
+	flightMode    profileMode = "Trace flight recorder"
+	metricsMode   profileMode = "Metrics"
 
 	// DefaultPath holds the default path where to create pprof file
 	DefaultPath = "./"
 
+	// DefaultDirMode holds the default permissions of the directories created for profile files
+	DefaultDirMode os.FileMode = 0700
+
+	// DefaultFileMode holds the default permissions of profile files, profiles may contain sensitive symbol data
+	DefaultFileMode os.FileMode = 0600
+
 	/*
 		DefaultMemProfileRate holds the default memory profiling rate
 		See also http://golang.org/pkg/runtime/#pkg-variables
@@ -41,11 +52,10 @@ const (
 	MemProfileAllocs MemProfileType = "allocs"
 
 	// Supported logging level
-	debugLevel logLevel = "debug"
-	infoLevel  logLevel = "info"
-	warnLevel  logLevel = "warn"
-	errorLevel logLevel = "error"
-	fatalLevel logLevel = "fatal"
+	LevelDebug Level = "debug"
+	LevelInfo  Level = "info"
+	LevelWarn  Level = "warn"
+	LevelError Level = "error"
 )
 
 // Profile represents a profiling session
@@ -68,12 +78,24 @@ type Profile struct {
 	// fileName holds the name of the file created by the profile
 	fileName string
 
+	// fileNamePrefix holds a prefix added to the name of all files written by the profile
+	fileNamePrefix string
+
 	// filePath holds the path to the file created by the profile
 	filePath string
 
-	// file holds the reference to the file created by the profile
+	// file holds the reference to the temporary file written by the profile, renamed to filePath once flushed
 	file *os.File
 
+	// tmpFilePath holds the path to the temporary file written by the profile
+	tmpFilePath string
+
+	// dirMode holds the permissions of the directories created for profile files
+	dirMode os.FileMode
+
+	// fileMode holds the permissions of profile files
+	fileMode os.FileMode
+
 	// panicIfFail holds the flag to decide whether a profile failure causes a panic
 	panicIfFail bool
 
@@ -83,6 +105,45 @@ type Profile struct {
 	// quiet suppresses informational messages during profiling
 	quiet bool
 
+	// manifest enables writing a JSON manifest next to the profile file on every flush
+	manifest bool
+
+	// labels holds user-supplied labels describing the profile
+	labels map[string]string
+
+	// embedMetadata enables rewriting the profile file to embed labels and comments into it
+	embedMetadata bool
+
+	// comments holds user-supplied comments to embed into the profile file
+	comments []string
+
+	// topN holds the number of functions of the top summary logged on stop
+	topN int
+
+	// topSampleType holds the sample type used to rank functions of the top summary
+	topSampleType string
+
+	// delta enables writing only the difference between the profile at Start and at Stop
+	delta bool
+
+	/*
+		deltaBase holds the snapshot of the profile taken at Start, used as base in delta mode
+		It is parsed only at Stop, so parsing allocations do not end up in delta memory profiles
+	*/
+	deltaBase []byte
+
+	// disabled turns Start and Stop into no-op, see EnvModes
+	disabled bool
+
+	// flight holds the flight recorder configurations and state, only for Trace flight recorder mode
+	flight *flightRecorderState
+
+	// leaks holds the goroutine leak detection configurations and state, only for Goroutine mode
+	leaks *leakDetectionState
+
+	// metrics holds the runtime metrics sampling configurations and state, only for Metrics mode
+	metrics *metricsState
+
 	/*
 		memProfileRate holds the rate for the memory profile
 		See DefaultMemProfileRate for default value
@@ -102,17 +163,50 @@ type Profile struct {
 	*/
 	internalCloser func()
 
+	// sinks holds the destinations every successfully flushed profile file is sent to
+	sinks []Sink
+
+	// notifiers holds the notifiers informed of every completed profile
+	notifiers []Notifier
+
+	// preStartHook holds a custom function that run right before profiling Start
+	preStartHook func(mode, filePath string)
+
+	// resultHook holds a custom function that run after profiling Stop, with the result of the session
+	resultHook func(result Result)
+
 	// closerHook holds a custom cleanup function that run after profiling Stop
 	closerHook func()
 
-	// Logger offers the possibility to inject a custom logger
-	logger Logger
+	// logger holds the structured logger all messages are logged through
+	logger StructuredLogger
+
+	// logLevel holds the minimum level of logged messages, blank logs all levels
+	logLevel Level
 
 	// previousMemProfileRate keeps track of the previous runtime.MemProfileRate value
 	previousMemProfileRate int
 
 	// started records if a call to profile.Start has already been made
 	started uint32
+
+	// startTime holds the time at which the profiling session started
+	startTime time.Time
+
+	// stopTime holds the time at which the profiling session stopped
+	stopTime time.Time
+
+	// errMu guards err, errors may be recorded by background goroutines
+	errMu sync.Mutex
+
+	// err holds the first error the current profiling session hit
+	err error
+
+	// size holds the size of the last flushed profile file
+	size int64
+
+	// location holds where the last flushed profile file was delivered to by sinks, if any
+	location string
 }
 
 // Config holds configurations to create a new Profile
@@ -126,6 +220,22 @@ type Config struct {
 	// UseTempPath let the path be generated by "ioutil.TempDir"
 	UseTempPath bool
 
+	/*
+		FileNamePrefix holds a prefix added to the name of all files written by the profile
+		For example "api." writes "api.cpu.pprof" instead of "cpu.pprof"
+	*/
+	FileNamePrefix string
+
+	// DirMode holds the permissions of the directories created for profile files, see DefaultDirMode for default
+	DirMode os.FileMode
+
+	/*
+		FileMode holds the permissions of profile files (and manifests, reports, etc), see DefaultFileMode for default
+		Files are written to a temporary file next to the final one, then synced and renamed on successful flush,
+		so a crash or a failed flush never leaves a partial file
+	*/
+	FileMode os.FileMode
+
 	// PanicIfFail holds the flag to decide whether a profile failure causes a panic
 	PanicIfFail bool
 
@@ -135,6 +245,46 @@ type Config struct {
 	// Quiet suppresses informational messages during profiling
 	Quiet bool
 
+	/*
+		Manifest enables writing a JSON manifest next to the profile file on every flush
+		See Manifest type for the content
+	*/
+	Manifest bool
+
+	// Labels holds user-supplied labels describing the profile (e.g. service, version, environment, instance)
+	Labels map[string]string
+
+	/*
+		EmbedMetadata enables rewriting the profile file to embed Labels and Comments into it.
+		Labels are added as comments and as string labels of every sample, so they show up in "go tool pprof".
+		Not available for Trace profiling.
+	*/
+	EmbedMetadata bool
+
+	// Comments holds custom comments to embed into the profile file, see EmbedMetadata
+	Comments []string
+
+	/*
+		TopN enables logging a top-N flat/cumulative functions summary right after profiling Stop
+		(same as "go tool pprof -top"). Not available for Trace profiling.
+	*/
+	TopN int
+
+	/*
+		TopSampleType holds the sample type used to rank functions of the top summary
+		Available values:   cpu | alloc_space | alloc_objects | inuse_space | inuse_objects | contentions | delay | goroutine |
+		                    threadcreate
+		If blank, the profile default sample type is used
+	*/
+	TopSampleType string
+
+	/*
+		Delta enables writing only the difference between the profile snapshots taken at Start and at Stop,
+		instead of the cumulative profile since process start (same as net/http/pprof "?seconds=" parameter).
+		Available for Memory profiling of type allocs, Mutex and Block profiling.
+	*/
+	Delta bool
+
 	/*
 		MemProfileRate holds the rate for the memory profile
 		See DefaultMemProfileRate for default value
@@ -148,11 +298,91 @@ type Config struct {
 	*/
 	MemProfileType MemProfileType
 
-	// CloserHook holds a custom cleanup function that run after profiling Stop
+	// GoroutineLeakDetection enables reporting goroutine stacks whose count kept growing during Goroutine profiling
+	GoroutineLeakDetection bool
+
+	/*
+		GoroutineLeakInterval holds the interval at which goroutine stacks are captured for leak detection,
+		in addition to Start and Stop. If not positive, stacks are captured only at Start and Stop
+	*/
+	GoroutineLeakInterval time.Duration
+
+	/*
+		MetricsInterval holds the interval at which runtime metrics are sampled during Metrics profiling
+		See DefaultMetricsInterval for default value
+	*/
+	MetricsInterval time.Duration
+
+	/*
+		MetricsFormat holds the format of the runtime metrics timeseries file
+		Available values:   jsonl | csv
+		See DefaultMetricsFormat for default
+	*/
+	MetricsFormat MetricsFormat
+
+	/*
+		FlightRecorderWindow holds the minimum age of the execution trace kept in memory by the flight recorder
+		See DefaultFlightRecorderWindow for default value
+	*/
+	FlightRecorderWindow time.Duration
+
+	/*
+		FlightRecorderMaxBytes holds the maximum size of the execution trace kept in memory by the flight recorder,
+		it takes precedence over FlightRecorderWindow. See DefaultFlightRecorderMaxBytes for default value
+	*/
+	FlightRecorderMaxBytes uint64
+
+	// FlightRecorderSignals holds the signals that make the flight recorder dump the recent execution trace to file
+	FlightRecorderSignals []os.Signal
+
+	// FlightRecorderTrigger makes the flight recorder dump the recent execution trace to file on every receive
+	FlightRecorderTrigger <-chan struct{}
+
+	/*
+		Sinks holds the destinations every successfully flushed profile file (and manifest) is sent to, in order
+		See s3sink package for an S3-compatible object store uploader
+	*/
+	Sinks []Sink
+
+	// Notifiers holds the notifiers informed of every completed profile, after sinks, see webhook package
+	Notifiers []Notifier
+
+	/*
+		PreStartHook holds a custom function that run right before profiling Start, with the profiling mode
+		short name (cpu, mem, mutex, etc) and the path of the file that will be written
+	*/
+	PreStartHook func(mode, filePath string)
+
+	/*
+		ResultHook holds a custom function that run after profiling Stop, with the result of the session
+		It runs after sinks and notifiers, and before CloserHook
+	*/
+	ResultHook func(result Result)
+
+	// CloserHook holds a custom cleanup function that run after profiling Stop, see ResultHook to receive the result
 	CloserHook func()
 
-	// Logger offers the possibility to inject a custom logger
+	// Logger offers the possibility to inject a custom logger, see StructuredLogger for a structured alternative
 	Logger Logger
+
+	/*
+		StructuredLogger offers the possibility to inject a custom structured logger, receiving messages with
+		key-value fields (mode, path, bytes, etc), it takes precedence over Logger
+		See FromStdLogger and FromSlogHandler for adapters
+	*/
+	StructuredLogger StructuredLogger
+
+	/*
+		LogWriter holds the writer messages are printed to when neither Logger nor StructuredLogger is set
+		If nil, messages are printed to stderr, so they never mix with the output of the application
+	*/
+	LogWriter io.Writer
+
+	/*
+		LogLevel holds the minimum level of logged messages, whatever the logger, blank logs all levels
+		Available values:   LevelDebug | LevelInfo | LevelWarn | LevelError
+	*/
+	LogLevel Level
 }
 
 // MemProfileType defines which type of memory profiling you want to start
@@ -161,10 +391,13 @@ type MemProfileType string
 // profileMode defined which profiling mode has to be run
 type profileMode string
 
-// logLevel defines the level at which a message has to be logged
-type logLevel string
+// Level defines the level at which a message has to be logged
+type Level string
 
-// Logger defines the interface an external logger have to implement, to be passed and used by multi-profile
+/*
+	Logger defines the interface an external logger have to implement, to be passed and used by multi-profile
+	Fatal and Fatalf are never called, multi-profile never exits the application
+*/
 type Logger interface {
 	Debug(...interface{})
 	Info(...interface{})
@@ -220,23 +453,47 @@ func TraceProfile(cfg *Config) *Profile {
 
 // ThreadCreationProfile creates a thread creation profiling object
 func ThreadCreationProfile(cfg *Config) *Profile {
-	return buildProfile(threadMode, "thread", "thread.pprof", cfg)
+	return buildProfile(threadMode, "threadcreate", "thread.pprof", cfg)
 }
 
 // GoroutineProfile creates a goroutine profiling object
 func GoroutineProfile(cfg *Config) *Profile {
-	return buildProfile(goroutineMode, "goroutine", "goroutine.pprof", cfg)
+	goroutinePprof := buildProfile(goroutineMode, "goroutine", "goroutine.pprof", cfg)
+	if cfg.GoroutineLeakDetection {
+		goroutinePprof.leaks = &leakDetectionState{interval: cfg.GoroutineLeakInterval}
+	}
+	return goroutinePprof
 }
 
 // Start starts a new profiling session
 func (p *Profile) Start() *Profile {
+	if p.disabled {
+		// no-op, profiling mode disabled by environment, see EnvModes
+		return p
+	}
+
 	if !atomic.CompareAndSwapUint32(&p.started, 0, 1) {
 		// no-op, profiling already started
 		return p
 	}
 
+	p.startTime = time.Now()
+	p.setErr(nil)
+	p.size = 0
+	p.location = ""
+	selfMetrics.sessionStarted(p.mode)
+	activeProfiles.add(p)
 	p.preparePath()
 
+	if p.preStartHook != nil {
+		filePath := filepath.Join(p.path, p.fileName)
+		if p.mode == flightMode {
+			// dump file names are known only at dump time
+			filePath = ""
+		}
+		p.preStartHook(modeEnvNames[p.mode], filePath)
+	}
+
 	switch p.mode {
 	case cpuMode:
 		p.startCpuMode()
@@ -258,6 +515,12 @@ func (p *Profile) Start() *Profile {
 
 	case goroutineMode:
 		p.startGoroutineMode()
+
+	case flightMode:
+		p.startFlightMode()
+
+	case metricsMode:
+		p.startMetricsMode()
 	}
 
 	p.startInterruptHook()
@@ -274,11 +537,42 @@ func (p *Profile) Stop() {
 		// no-op, profiling already stopped
 		return
 	}
+	defer selfMetrics.sessionStopped(p.mode)
+	activeProfiles.remove(p)
 
+	flushStart := time.Now()
 	if p.internalCloser != nil {
 		p.internalCloser()
 	}
+	flushDuration := time.Since(flushStart)
 
+	p.stopTime = time.Now()
+	// a failed session left the previous file in place, it must not be rewritten, measured nor reported as its output
+	if p.sessionErr() == nil {
+		if p.embedMetadata {
+			p.embedFileMetadata()
+		}
+		if p.mode != flightMode {
+			// flight recorder records a flush for every dump
+			p.recordFlush(flushDuration)
+		}
+		if p.manifest && p.mode != flightMode {
+			// flight recorder writes a manifest for every dump
+			p.writeManifest()
+		}
+		if p.topN > 0 {
+			p.logTop()
+		}
+	}
+	if p.mode != flightMode {
+		// flight recorder sends every dump to sinks and notifiers
+		p.sendToSinks()
+		p.notify()
+	}
+
+	if p.resultHook != nil {
+		p.resultHook(p.result())
+	}
 	if p.closerHook != nil {
 		p.closerHook()
 	}
@@ -290,7 +584,7 @@ func (p *Profile) startCpuMode() {
 
 	err := pprof.StartCPUProfile(p.file)
 	if err != nil {
-		p.logf(errorLevel, "CPU profiling start failed: %s", err.Error())
+		p.failf("CPU profiling start failed: %s", err.Error())
 		if p.panicIfFail {
 			panic(err)
 		}
@@ -298,7 +592,7 @@ func (p *Profile) startCpuMode() {
 
 	p.internalCloser = p.stopCpuMode
 
-	p.logf(infoLevel, "CPU profiling enabled, file %s", p.filePath)
+	p.logf(LevelInfo, "CPU profiling enabled, file %s", p.filePath)
 }
 
 // startMemMode starts memory profiling
@@ -308,8 +602,9 @@ func (p *Profile) startMemMode() {
 	p.previousMemProfileRate = runtime.MemProfileRate
 	runtime.MemProfileRate = p.memProfileRate
 	p.internalCloser = p.stopMemMode
+	p.startDelta()
 
-	p.logf(infoLevel, "Memory profiling (%s) enabled at rate %d, file %s",
+	p.logf(LevelInfo, "Memory profiling (%s) enabled at rate %d, file %s",
 		p.memProfileType, runtime.MemProfileRate, p.filePath)
 }
 
@@ -319,8 +614,9 @@ func (p *Profile) startMutexMode() {
 
 	runtime.SetMutexProfileFraction(1)
 	p.internalCloser = p.stopMutexMode
+	p.startDelta()
 
-	p.logf(infoLevel, "Mutex profiling enabled, file %s", p.filePath)
+	p.logf(LevelInfo, "Mutex profiling enabled, file %s", p.filePath)
 }
 
 // startBlockMode starts block profiling
@@ -329,8 +625,9 @@ func (p *Profile) startBlockMode() {
 
 	runtime.SetBlockProfileRate(1)
 	p.internalCloser = p.stopBlockMode
+	p.startDelta()
 
-	p.logf(infoLevel, "Block profiling enabled, file %s", p.filePath)
+	p.logf(LevelInfo, "Block profiling enabled, file %s", p.filePath)
 }
 
 // startTraceMode starts trace profiling
@@ -339,7 +636,7 @@ func (p *Profile) startTraceMode() {
 
 	err := trace.Start(p.file)
 	if err != nil {
-		p.logf(errorLevel, "Trace profiling start failed: %s", err.Error())
+		p.failf("Trace profiling start failed: %s", err.Error())
 		if p.panicIfFail {
 			panic(err)
 		}
@@ -347,7 +644,7 @@ func (p *Profile) startTraceMode() {
 
 	p.internalCloser = p.stopTraceMode
 
-	p.logf(infoLevel, "Trace profiling enabled, file %s", p.filePath)
+	p.logf(LevelInfo, "Trace profiling enabled, file %s", p.filePath)
 }
 
 // startThreadCreationMode starts thread creation profiling
@@ -356,7 +653,7 @@ func (p *Profile) startThreadCreationMode() {
 
 	p.internalCloser = p.stopThreadCreationMode
 
-	p.logf(infoLevel, "Thread profiling enabled, file %s", p.filePath)
+	p.logf(LevelInfo, "Thread profiling enabled, file %s", p.filePath)
 }
 
 // startGoroutineMode starts goroutine profiling
@@ -365,20 +662,22 @@ func (p *Profile) startGoroutineMode() {
 
 	p.internalCloser = p.stopGoroutineMode
 
-	p.logf(infoLevel, "Goroutine profiling enabled, file %s", p.filePath)
+	p.logf(LevelInfo, "Goroutine profiling enabled, file %s", p.filePath)
+
+	p.startLeakDetection()
 }
 
 // stopCpuMode stops cpu profiling
 func (p *Profile) stopCpuMode() {
-	p.logf(infoLevel, "Stop and flush CPU profiling to file %s", p.filePath)
+	p.logf(LevelInfo, "Stop and flush CPU profiling to file %s", p.filePath)
 
 	pprof.StopCPUProfile()
-	err := p.file.Close()
+	err := p.closeFile()
 	if err != nil {
-		p.logf(errorLevel, "CPU profiling flushing data to file %q failed: %s", p.filePath, err.Error())
+		p.failf("CPU profiling flushing data to file %q failed: %s", p.filePath, err.Error())
 	}
 
-	p.log(infoLevel, "CPU profiling disabled")
+	p.log(LevelInfo, "CPU profiling disabled")
 }
 
 // stopMemMode stops memory profiling
@@ -405,11 +704,15 @@ func (p *Profile) stopBlockMode() {
 
 // stopTraceMode stops trace profiling
 func (p *Profile) stopTraceMode() {
-	p.logf(infoLevel, "Stop and flush trace profiling to file %s", p.filePath)
+	p.logf(LevelInfo, "Stop and flush trace profiling to file %s", p.filePath)
 
 	trace.Stop()
+	err := p.closeFile()
+	if err != nil {
+		p.failf("Trace profiling flushing data to file %q failed: %s", p.filePath, err.Error())
+	}
 
-	p.log(infoLevel, "Trace profiling disabled")
+	p.log(LevelInfo, "Trace profiling disabled")
 }
 
 // stopThreadCreationMode stops thread creation profiling
@@ -419,51 +722,94 @@ func (p *Profile) stopThreadCreationMode() {
 
 // stopGoroutineMode stops goroutine profiling
 func (p *Profile) stopGoroutineMode() {
+	p.stopLeakDetection()
+
 	p.stopAndFlush()
+
+	p.writeLeakReport()
 }
 
 // startInterruptHook starts the interruptHook function in a separate goroutine
 func (p *Profile) startInterruptHook() {
 	if p.enableInterruptHook {
-		p.logf(infoLevel, "Start interrupt hook for %s profiling", string(p.mode))
+		p.logf(LevelInfo, "Start interrupt hook for %s profiling", string(p.mode))
 		go p.interruptHook()
 	}
 }
 
 // interruptHook waits for interruption signals and stop the profiling
 func (p *Profile) interruptHook() {
-	syscallCh := make(chan os.Signal)
+	syscallCh := make(chan os.Signal, 1)
 	signal.Notify(syscallCh, syscall.SIGTERM, syscall.SIGINT, os.Interrupt)
 	<-syscallCh
 
-	p.logf(warnLevel, "Caught interrupt signal, stop and flush %s profiling to file", string(p.mode))
+	p.logf(LevelWarn, "Caught interrupt signal, stop and flush %s profiling to file", string(p.mode))
 	p.Stop()
 }
 
 // buildProfile builds a Profile using input parameters
 func buildProfile(mode profileMode, lookupName, fileName string, cfg *Config) *Profile {
-	return &Profile{
+	prof := &Profile{
 		mode:                mode,
 		lookupName:          lookupName,
 		path:                cfg.Path,
 		useTempPath:         cfg.UseTempPath,
-		fileName:            fileName,
+		fileName:            cfg.FileNamePrefix + fileName,
+		fileNamePrefix:      cfg.FileNamePrefix,
+		dirMode:             cfg.DirMode,
+		fileMode:            cfg.FileMode,
 		panicIfFail:         cfg.PanicIfFail,
 		enableInterruptHook: cfg.EnableInterruptHook,
 		quiet:               cfg.Quiet,
-		logger:              cfg.Logger,
+		manifest:            cfg.Manifest,
+		labels:              cfg.Labels,
+		embedMetadata:       cfg.EmbedMetadata,
+		comments:            cfg.Comments,
+		topN:                cfg.TopN,
+		topSampleType:       cfg.TopSampleType,
+		delta:               cfg.Delta,
+		logger:              newStructuredLogger(cfg),
+		logLevel:            cfg.LogLevel,
+		sinks:               cfg.Sinks,
+		notifiers:           cfg.Notifiers,
+		preStartHook:        cfg.PreStartHook,
+		resultHook:          cfg.ResultHook,
 		closerHook:          cfg.CloserHook,
 		started:             0,
 	}
+	if prof.dirMode == 0 {
+		prof.dirMode = DefaultDirMode
+	}
+	if prof.fileMode == 0 {
+		prof.fileMode = DefaultFileMode
+	}
+	prof.applyEnv()
+	return prof
 }
 
-// createFile creates the file that the profile will use to flush results into
+// writesPprof returns true if the profile writes a pprof profile (e.g. not an execution trace or a metrics timeseries)
+func (p *Profile) writesPprof() bool {
+	switch p.mode {
+	case traceMode, flightMode, metricsMode:
+		return false
+	default:
+		return true
+	}
+}
+
+/*
+	createFile creates the temporary file that the profile will use to flush results into
+	See closeFile to rename it to the profile file
+*/
 func (p *Profile) createFile() {
 	p.filePath = filepath.Join(p.path, p.fileName)
+	p.tmpFilePath = tempFilePath(p.filePath)
 	var err error
-	p.file, err = os.Create(p.filePath)
+	p.file, err = os.OpenFile(p.tmpFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, p.fileMode)
 	if err != nil {
-		p.logf(errorLevel, "%s profiling file %s creation failed: %s",
+		// the nil *os.File returned on error must not be used
+		p.file = nil
+		p.failf("%s profiling file %s creation failed: %s",
 			string(p.mode), p.filePath, err.Error())
 		if p.panicIfFail {
 			panic(err)
@@ -471,28 +817,91 @@ func (p *Profile) createFile() {
 	}
 }
 
+/*
+	closeFile syncs and closes the temporary file, then renames it to the profile file
+	If the session failed, the temporary file is removed, leaving any previous profile file untouched
+*/
+func (p *Profile) closeFile() error {
+	if p.file == nil {
+		// creation failed, already reported
+		return nil
+	}
+	file := p.file
+	p.file = nil
+
+	if p.sessionErr() != nil {
+		_ = file.Close()
+		_ = os.Remove(p.tmpFilePath)
+		return nil
+	}
+	return commitFile(file, p.tmpFilePath, p.filePath, nil)
+}
+
+// writeFile writes data to the file at the given path, through a temporary file renamed once synced
+func (p *Profile) writeFile(path string, data []byte) error {
+	tmpPath := tempFilePath(path)
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, p.fileMode)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	return commitFile(file, tmpPath, path, err)
+}
+
+// tempFilePath returns the path to the hidden temporary file written before the file at the given path
+func tempFilePath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+}
+
+/*
+	commitFile syncs and closes the temporary file, then renames it to path, unless writing it failed with err
+	On failure the temporary file is removed
+*/
+func commitFile(file *os.File, tmpPath, path string, err error) error {
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+	}
+	return err
+}
+
 // stopAndFlush stops profiling and flushes results to file (valid for all modes except CPU and Trace)
 func (p *Profile) stopAndFlush() {
-	p.logf(infoLevel, "Stop and flush %s lookup for %s profiling to file %s", p.lookupName, string(p.mode), p.filePath)
-	pprofile := pprof.Lookup(p.lookupName)
-	if pprofile != nil {
-		err := pprofile.WriteTo(p.file, 0)
+	p.logf(LevelInfo, "Stop and flush %s lookup for %s profiling to file %s", p.lookupName, string(p.mode), p.filePath)
+	lookupProfile := pprof.Lookup(p.lookupName)
+	if lookupProfile != nil {
+		var err error
+		if p.deltaBase != nil {
+			err = p.writeDelta(lookupProfile)
+		} else {
+			err = lookupProfile.WriteTo(p.file, 0)
+		}
 		if err != nil {
-			p.logf(errorLevel, "%s profiling flushing data to file %s failed: %s",
+			p.failf("%s profiling flushing data to file %s failed: %s",
 				string(p.mode), p.filePath, err.Error())
 		}
 	} else {
-		p.logf(errorLevel, "%s profiling flushing data to file %s failed: pprof lookup returned nil profile",
+		p.failf("%s profiling flushing data to file %s failed: pprof lookup returned nil profile",
 			string(p.mode), p.filePath)
 	}
 
-	err := p.file.Close()
+	err := p.closeFile()
 	if err != nil {
-		p.logf(errorLevel, "%s profiling flushing data to file %s failed: %s",
+		p.failf("%s profiling flushing data to file %s failed: %s",
 			string(p.mode), p.filePath, err.Error())
 	}
 
-	p.logf(infoLevel, "%s profiling disabled", string(p.mode))
+	p.logf(LevelInfo, "%s profiling disabled", string(p.mode))
 }
 
 // preparePath prepares the file path to flush data into when profiling will be stopped
@@ -504,7 +913,7 @@ func (p *Profile) preparePath() {
 		err = p.prepareCustomPath()
 	}
 	if err != nil {
-		p.logf(errorLevel, "%s profiling start aborted, could not create output directory: %s",
+		p.failf("%s profiling start aborted, could not create output directory: %s",
 			string(p.mode), err.Error())
 		if p.panicIfFail {
 			panic(err)
@@ -523,7 +932,7 @@ func (p *Profile) prepareCustomPath() error {
 	}
 
 	if p.path != DefaultPath {
-		mkdirErr := os.MkdirAll(p.path, 0777)
+		mkdirErr := os.MkdirAll(p.path, p.dirMode)
 		if mkdirErr != nil {
 			return mkdirErr
 		}
@@ -539,53 +948,54 @@ func (p *Profile) prepareTempPath() error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return os.Chmod(p.path, p.dirMode)
 }
 
 // log abstracts the complexity of using an external specific logger
-func (p *Profile) log(level logLevel, args ...interface{}) {
-	if !p.quiet {
-		if p.logger != nil {
-			switch level {
-			case debugLevel:
-				p.logger.Debug(args...)
-			case infoLevel:
-				p.logger.Info(args...)
-			case warnLevel:
-				p.logger.Warn(args...)
-			case errorLevel:
-				p.logger.Error(args...)
-			case fatalLevel:
-				p.logger.Fatal(args...)
-			default:
-				p.logger.Info(args...)
-			}
-		} else {
-			fmt.Print(fmt.Sprintf("[%s]", level), args, "\n")
-		}
-	}
+func (p *Profile) log(level Level, args ...interface{}) {
+	p.logw(level, fmt.Sprint(args...))
 }
 
 // logf abstracts the complexity of using an external specific logger
-func (p *Profile) logf(level logLevel, template string, args ...interface{}) {
-	if !p.quiet {
-		if p.logger != nil {
-			switch level {
-			case debugLevel:
-				p.logger.Debugf(template, args...)
-			case infoLevel:
-				p.logger.Infof(template, args...)
-			case warnLevel:
-				p.logger.Warnf(template, args...)
-			case errorLevel:
-				p.logger.Errorf(template, args...)
-			case fatalLevel:
-				p.logger.Fatalf(template, args...)
-			default:
-				p.logger.Infof(template, args...)
-			}
-		} else {
-			fmt.Printf("[%s] %s\n", level, fmt.Sprintf(template, args...))
-		}
+func (p *Profile) logf(level Level, template string, args ...interface{}) {
+	p.logw(level, fmt.Sprintf(template, args...))
+}
+
+// logw logs the message with the given key-value fields, adding the profiling mode
+func (p *Profile) logw(level Level, msg string, fields ...Field) {
+	if p.quiet || !p.logLevel.enabled(level) {
+		return
+	}
+	fields = append([]Field{{Key: "mode", Value: modeEnvNames[p.mode]}}, fields...)
+	p.logger.Log(level, msg, fields...)
+}
+
+/*
+	failf logs the error and records it as the error of the current profiling session
+	Only the first error is kept, the session is counted as failed once, see SelfMetrics
+*/
+func (p *Profile) failf(template string, args ...interface{}) {
+	err := fmt.Errorf(template, args...)
+	p.logf(LevelError, "%s", err.Error())
+
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	if p.err == nil {
+		p.err = err
+		selfMetrics.sessionFailed(p.mode)
 	}
 }
+
+// setErr overrides the error of the current profiling session
+func (p *Profile) setErr(err error) {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	p.err = err
+}
+
+// sessionErr returns the first error the current profiling session hit, nil if none
+func (p *Profile) sessionErr() error {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	return p.err
+}
@@ -43,11 +43,11 @@ func TestOptions(t *testing.T) {
 	}
 
 	checkPprofFiles(t, []string{
-		"./cpu.pprof", os.Getenv("HOME") + "/cpu.pprof",
+		"./cpu.pprof", "./cpu.manifest.json", "./mem.pprof", os.Getenv("HOME") + "/cpu.pprof",
 	})
 
 	cleanupPprofFiles(t, []string{
-		"./cpu.pprof", os.Getenv("HOME") + "/cpu.pprof",
+		"./cpu.pprof", "./cpu.manifest.json", "./mem.pprof", os.Getenv("HOME") + "/cpu.pprof",
 	})
 }
 
@@ -99,6 +99,17 @@ func Stderr(expectedLines ...string) checkFn {
 	}
 }
 
+// NotInStderr verifies that the given lines do not match the output from stderr
+func NotInStderr(expectedLines ...string) checkFn {
+	return func(t *testing.T, stdout, stderr []byte, err error) {
+		for _, expected := range expectedLines {
+			if validateOutput(stderr, expected) {
+				t.Errorf("stderr: '%s' was not expected, but found in stderr '%s'", expected, stderr)
+			}
+		}
+	}
+}
+
 // NoStderr checks that stderr was blank
 func NoStderr(t *testing.T, stdout, stderr []byte, err error) {
 	if len(stderr) > 0 {
@@ -17,9 +17,9 @@ var profileTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("cpu profiling enabled", "cpu profiling disabled"),
-			NotInStdout("panic situation recovered"),
-			NoStderr,
+			Stderr("cpu profiling enabled", "cpu profiling disabled"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
 			NoErr,
 		},
 	},
@@ -35,9 +35,9 @@ var profileTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("memory profiling (heap) enabled", "memory profiling disabled"),
-			NotInStdout("panic situation recovered"),
-			NoStderr,
+			Stderr("memory profiling (heap) enabled", "memory profiling disabled"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
 			NoErr,
 		},
 	},
@@ -53,9 +53,9 @@ var profileTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("memory profiling (allocs) enabled", "memory profiling disabled"),
-			NotInStdout("panic situation recovered"),
-			NoStderr,
+			Stderr("memory profiling (allocs) enabled", "memory profiling disabled"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
 			NoErr,
 		},
 	},
@@ -71,9 +71,9 @@ var profileTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("memory profiling (heap) enabled at rate 1024", "memory profiling disabled"),
-			NotInStdout("panic situation recovered"),
-			NoStderr,
+			Stderr("memory profiling (heap) enabled at rate 1024", "memory profiling disabled"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
 			NoErr,
 		},
 	},
@@ -89,9 +89,9 @@ var profileTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("mutex profiling enabled", "mutex profiling disabled"),
-			NotInStdout("panic situation recovered"),
-			NoStderr,
+			Stderr("mutex profiling enabled", "mutex profiling disabled"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
 			NoErr,
 		},
 	},
@@ -107,9 +107,9 @@ var profileTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("block profiling enabled", "block profiling disabled"),
-			NotInStdout("panic situation recovered"),
-			NoStderr,
+			Stderr("block profiling enabled", "block profiling disabled"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
 			NoErr,
 		},
 	},
@@ -125,9 +125,9 @@ var profileTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("trace profiling enabled", "trace profiling disabled"),
-			NotInStdout("panic situation recovered"),
-			NoStderr,
+			Stderr("trace profiling enabled", "trace profiling disabled"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
 			NoErr,
 		},
 	},
@@ -143,9 +143,9 @@ var profileTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("thread profiling enabled", "thread profiling disabled"),
-			NotInStdout("panic situation recovered"),
-			NoStderr,
+			Stderr("thread profiling enabled", "thread profiling disabled"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
 			NoErr,
 		},
 	},
@@ -161,9 +161,9 @@ var profileTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("goroutine profiling enabled", "goroutine profiling disabled"),
-			NotInStdout("panic situation recovered"),
-			NoStderr,
+			Stderr("goroutine profiling enabled", "goroutine profiling disabled"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
 			NoErr,
 		},
 	},
@@ -180,10 +180,10 @@ var profileTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("cpu profiling enabled", "cpu profiling disabled",
+			Stderr("cpu profiling enabled", "cpu profiling disabled",
 				"memory profiling (heap) enabled", "memory profiling disabled"),
-			NotInStdout("panic situation recovered"),
-			NoStderr,
+			NotInStderr("panic situation recovered"),
+			NoStdout,
 			NoErr,
 		},
 	},
@@ -199,7 +199,7 @@ var profileTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("permission denied"),
+			Stderr("permission denied"),
 			NoErr,
 		},
 	},
@@ -238,9 +238,9 @@ var optionsTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("cpu profiling enabled", "cpu profiling disabled", os.Getenv("HOME")+"/cpu.pprof"),
-			NotInStdout("panic situation recovered"),
-			NoStderr,
+			Stderr("cpu profiling enabled", "cpu profiling disabled", os.Getenv("HOME")+"/cpu.pprof"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
 			NoErr,
 		},
 	},
@@ -256,9 +256,9 @@ var optionsTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("cpu profiling enabled", "cpu profiling disabled", "profile_"),
-			NotInStdout("panic situation recovered"),
-			NoStderr,
+			Stderr("cpu profiling enabled", "cpu profiling disabled", "profile_"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
 			NoErr,
 		},
 	},
@@ -275,8 +275,8 @@ var optionsTests = []profileTest{
 
 			`,
 		checks: []checkFn{
-			Stdout("cpu profiling enabled", "start interrupt hook", "cpu profiling disabled"),
-			NotInStdout("panic situation recovered"),
+			Stderr("cpu profiling enabled", "start interrupt hook", "cpu profiling disabled"),
+			NotInStderr("panic situation recovered"),
 			NoErr,
 		},
 	},
@@ -299,11 +299,70 @@ var optionsTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("cpu profiling enabled", "cpu profiling disabled", "custom closer"),
-			NotInStdout("panic situation recovered"),
+			Stderr("cpu profiling enabled", "cpu profiling disabled"),
+			Stdout("custom closer"),
+			NotInStderr("panic situation recovered"),
 			NoErr,
 		},
 	},
+	{
+		name: "manifest option",
+		code: `
+			package main
+	
+			import "github.com/bygui86/multi-profile/v2"
+	
+			func main() {
+				defer profile.CPUProfile(&profile.Config{Manifest: true, Labels: map[string]string{"service": "test"}}).Start().Stop()
+			}
+			`,
+		checks: []checkFn{
+			Stderr("cpu profiling enabled", "cpu profiling disabled", "cpu profiling manifest written to file cpu.manifest.json"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
+			NoErr,
+		},
+	},
+	{
+		name: "top summary option",
+		code: `
+			package main
+	
+			import "github.com/bygui86/multi-profile/v2"
+	
+			func main() {
+				defer profile.MemProfile(&profile.Config{TopN: 5, TopSampleType: "alloc_space"}).Start().Stop()
+			}
+			`,
+		checks: []checkFn{
+			Stderr("memory profiling (heap) enabled", "memory profiling top summary of file mem.pprof", "(alloc_space)"),
+			NotInStderr("panic situation recovered"),
+			NoStdout,
+			NoErr,
+		},
+	},
+	{
+		name: "guard option",
+		code: `
+			package main
+	
+			import (
+				"time"
+				"github.com/bygui86/multi-profile/v2"
+			)
+	
+			func main() {
+				defer profile.CPUProfile(&profile.Config{UseTempPath: true}).Start().Stop()
+				go profile.Guard(func() { panic("boom") })
+				time.Sleep(time.Second)
+			}
+			`,
+		checks: []checkFn{
+			Stderr("panic goroutine dump written to file", "panic caught: boom", "cpu profiling disabled", "panic: boom"),
+			NoStdout,
+			Err,
+		},
+	},
 	{
 		name: "custom path error",
 		code: `
@@ -316,8 +375,8 @@ var optionsTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("permission denied"),
-			NotInStdout("panic situation recovered"),
+			Stderr("permission denied"),
+			NotInStderr("panic situation recovered"),
 			NoErr,
 		},
 	},
@@ -333,7 +392,7 @@ var optionsTests = []profileTest{
 			}
 			`,
 		checks: []checkFn{
-			Stdout("permission denied"),
+			Stderr("permission denied"),
 			Err,
 		},
 	},
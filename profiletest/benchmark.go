@@ -0,0 +1,96 @@
+package profiletest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+/*
+	Benchmark writes one profile per sub-benchmark and mode, named after the benchmark, for example
+	"BenchmarkParse_json.cpu.pprof" for the sub-benchmark "json" of BenchmarkParse:
+
+		func BenchmarkParse(b *testing.B) {
+			bench := &profiletest.Benchmark{Modes: []profiletest.Mode{profiletest.CPU, profiletest.Mem}}
+			bench.Run(b, "json", func(b *testing.B) { ... })
+			bench.Run(b, "xml", func(b *testing.B) { ... })
+		}
+
+	The testing package runs a sub-benchmark several times growing b.N, each run overwrites the profiles of the
+	previous one, so the files hold the profile of the final, measured, run.
+	Profiles are written to a temporary directory removed at the end of the sub-benchmark, unless Dir is set.
+*/
+type Benchmark struct {
+	// Dir holds the directory profiles are kept in, a temporary directory of the sub-benchmark if blank
+	Dir string
+
+	// Modes holds the profiling modes of every sub-benchmark, CPU if empty
+	Modes []Mode
+
+	// Manifest writes a manifest next to every profile, see profile.Config
+	Manifest bool
+}
+
+// Run runs f as the sub-benchmark name of b, like b.Run, profiling it under all modes
+func (bm *Benchmark) Run(b *testing.B, name string, f func(b *testing.B)) bool {
+	b.Helper()
+
+	return b.Run(name, func(b *testing.B) {
+		fileName := b.Name()
+		if fileName == "" {
+			// benchmarks run by testing.Benchmark have no name
+			fileName = name
+		}
+
+		b.StopTimer()
+		profiles := bm.start(b, benchmarkFileName(fileName))
+		b.StartTimer()
+
+		f(b)
+
+		b.StopTimer()
+		for _, prof := range profiles {
+			prof.Stop()
+		}
+		b.StartTimer()
+	})
+}
+
+// start starts the profiles of all modes for the given sub-benchmark, failing it if a mode is not supported
+func (bm *Benchmark) start(b *testing.B, fileName string) []*profile.Profile {
+	dir := bm.Dir
+	if dir == "" {
+		dir = b.TempDir()
+	}
+	modes := bm.Modes
+	if len(modes) == 0 {
+		modes = []Mode{CPU}
+	}
+
+	profiles := make([]*profile.Profile, 0, len(modes))
+	for _, mode := range modes {
+		prof := newProfile(mode, &profile.Config{
+			Path:           dir,
+			FileNamePrefix: fileName + ".",
+			Quiet:          true,
+			Delta:          true,
+			Manifest:       bm.Manifest,
+			ResultHook: func(result profile.Result) {
+				if result.Err != nil {
+					b.Errorf("profiletest: %s profiling failed: %s", result.Mode, result.Err)
+				}
+			},
+		})
+		if prof == nil {
+			b.Fatalf("profiletest: unsupported mode %q", mode)
+		}
+		profiles = append(profiles, prof.Start())
+	}
+	return profiles
+}
+
+// benchmarkFileName returns the benchmark name usable as file name, sub-benchmark separators become underscores
+func benchmarkFileName(name string) string {
+	return strings.NewReplacer("/", "_", " ", "_", ":", "_", "\\", "_").Replace(name)
+}
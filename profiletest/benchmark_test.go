@@ -0,0 +1,71 @@
+package profiletest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2/analysis"
+	"github.com/bygui86/multi-profile/v2/profiletest"
+)
+
+func BenchmarkAllocate(b *testing.B) {
+	bench := &profiletest.Benchmark{Dir: b.TempDir(), Modes: []profiletest.Mode{profiletest.CPU, profiletest.Mem}}
+	for _, name := range []string{"small", "large"} {
+		bench.Run(b, name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				allocate()
+			}
+		})
+
+		for _, mode := range []string{"cpu", "mem"} {
+			_, err := os.Stat(filepath.Join(bench.Dir, "BenchmarkAllocate_"+name+"."+mode+".pprof"))
+			if err != nil {
+				b.Error(err)
+			}
+		}
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	dir := t.TempDir()
+	result := testing.Benchmark(func(b *testing.B) {
+		bench := &profiletest.Benchmark{Dir: dir, Modes: []profiletest.Mode{profiletest.Mem}, Manifest: true}
+		bench.Run(b, "variant a", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				allocate()
+			}
+		})
+	})
+	assert.True(t, result.N > 0)
+
+	prof, err := analysis.Load(filepath.Join(dir, "variant_a.mem.pprof"))
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, prof.Sample)
+	}
+	assert.FileExists(t, filepath.Join(dir, "variant_a.mem.manifest.json"))
+}
+
+func TestBenchmarkTempDir(t *testing.T) {
+	result := testing.Benchmark(func(b *testing.B) {
+		bench := &profiletest.Benchmark{Modes: []profiletest.Mode{profiletest.Mem}}
+		bench.Run(b, "temp", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				allocate()
+			}
+		})
+	})
+	assert.True(t, result.N > 0)
+
+	// nothing is written to the source tree
+	entries, err := ioutil.ReadDir(".")
+	if assert.NoError(t, err) {
+		for _, entry := range entries {
+			assert.NotEqual(t, "profiles", entry.Name())
+			assert.NotContains(t, entry.Name(), ".pprof")
+		}
+	}
+}
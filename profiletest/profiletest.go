@@ -0,0 +1,287 @@
+/*
+	Package profiletest helps unit tests asserting on profiles: it runs a function under a profiling mode, keeping the
+	written profile in memory, then offers assertions on the parsed profile, for example:
+
+		prof := profiletest.Run(t, profiletest.CPU, func() { fib(30) })
+		prof.AssertShareAbove("main.fib", 0.5)
+
+		prof = profiletest.Run(t, profiletest.Mem, func() { parse(input) })
+		prof.AssertNoSamples("encoding/json.Unmarshal")
+
+		profiletest.AssertNoGoroutineLeak(t, func() { server.Shutdown() })
+*/
+package profiletest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pprofile "github.com/google/pprof/profile"
+
+	"github.com/bygui86/multi-profile/v2"
+	"github.com/bygui86/multi-profile/v2/analysis"
+)
+
+// Mode holds a profiling mode supported by Run
+type Mode string
+
+const (
+	// CPU profiles CPU usage, the function must run long enough to be sampled (100 samples per second)
+	CPU Mode = "cpu"
+
+	// Mem profiles allocations made while the function runs, recording every allocation
+	Mem Mode = "mem"
+
+	// Mutex profiles contended mutexes while the function runs
+	Mutex Mode = "mutex"
+
+	// Block profiles blocking events while the function runs
+	Block Mode = "block"
+
+	// Goroutine profiles the goroutines still running when the function returns
+	Goroutine Mode = "goroutine"
+)
+
+// DefaultGoroutineLeakTimeout holds the default time AssertNoGoroutineLeak waits for goroutines to exit
+const DefaultGoroutineLeakTimeout = time.Second
+
+// profileWriterFunction holds the function writing profiles, its allocations are dropped from Mem profiles
+const profileWriterFunction = "runtime/pprof.(*Profile).WriteTo"
+
+// Capture holds a profile file delivered to a MemorySink
+type Capture struct {
+	// Artifact describes the delivered profile
+	Artifact profile.Artifact
+
+	// Data holds the content of the profile file
+	Data []byte
+}
+
+// MemorySink keeps the profile files delivered by profiles in memory, it implements profile.Sink
+type MemorySink struct {
+	mu       sync.Mutex
+	captures []Capture
+}
+
+// Send reads the profile file of the artifact into memory
+func (s *MemorySink) Send(artifact profile.Artifact) (profile.Delivery, error) {
+	data, err := ioutil.ReadFile(artifact.Path)
+	if err != nil {
+		return profile.Delivery{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.captures = append(s.captures, Capture{Artifact: artifact, Data: data})
+	return profile.Delivery{Location: fmt.Sprintf("memory://%s/%d", artifact.Mode, len(s.captures))}, nil
+}
+
+// Captures returns the profile files delivered so far
+func (s *MemorySink) Captures() []Capture {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Capture(nil), s.captures...)
+}
+
+// Profile holds a parsed profile and offers assertions on it, failing the test they were created for
+type Profile struct {
+	*pprofile.Profile
+
+	// SampleType holds the sample type assertions refer to, blank for the default one of the profile
+	SampleType string
+
+	tb testing.TB
+}
+
+/*
+	Run runs fn under the given profiling mode and returns the parsed profile, failing the test if profiling fails
+	Mem, Mutex and Block profiles are delta profiles, holding only the events recorded while fn runs
+	Mem profiles do not hold the allocations made by the profiler writing the delta base
+*/
+func Run(tb testing.TB, mode Mode, fn func()) *Profile {
+	tb.Helper()
+
+	sink := &MemorySink{}
+	var result profile.Result
+	cfg := &profile.Config{
+		Path:           tb.TempDir(),
+		Quiet:          true,
+		Delta:          true,
+		MemProfileRate: 1,
+		Sinks:          []profile.Sink{sink},
+		ResultHook:     func(r profile.Result) { result = r },
+	}
+	prof := newProfile(mode, cfg)
+	if prof == nil {
+		tb.Fatalf("profiletest: unsupported mode %q", mode)
+		return nil
+	}
+
+	prof.Start()
+	fn()
+	prof.Stop()
+
+	if result.Err != nil {
+		tb.Fatalf("profiletest: %s profiling failed: %s", mode, result.Err)
+		return nil
+	}
+	captures := sink.Captures()
+	if len(captures) == 0 {
+		tb.Fatalf("profiletest: %s profiling wrote no profile", mode)
+		return nil
+	}
+	parsed, err := pprofile.ParseData(captures[len(captures)-1].Data)
+	if err != nil {
+		tb.Fatalf("profiletest: %s profile parsing failed: %s", mode, err)
+		return nil
+	}
+	if mode == Mem {
+		dropProfileWriterSamples(parsed)
+	}
+	return &Profile{Profile: parsed, tb: tb}
+}
+
+// newProfile returns a new profile of the given mode, nil if the mode is not supported
+func newProfile(mode Mode, cfg *profile.Config) *profile.Profile {
+	switch mode {
+	case CPU:
+		return profile.CPUProfile(cfg)
+	case Mem:
+		cfg.MemProfileType = profile.MemProfileAllocs
+		return profile.MemProfile(cfg)
+	case Mutex:
+		return profile.MutexProfile(cfg)
+	case Block:
+		return profile.BlockProfile(cfg)
+	case Goroutine:
+		return profile.GoroutineProfile(cfg)
+	default:
+		return nil
+	}
+}
+
+// dropProfileWriterSamples removes the samples recorded while writing profiles
+func dropProfileWriterSamples(prof *pprofile.Profile) {
+	samples := prof.Sample[:0]
+	for _, sample := range prof.Sample {
+		writer := false
+		for _, name := range analysis.StackFunctions(sample) {
+			if name == profileWriterFunction {
+				writer = true
+				break
+			}
+		}
+		if !writer {
+			samples = append(samples, sample)
+		}
+	}
+	prof.Sample = samples
+}
+
+/*
+	Value returns the total value of the samples with the function in their stack, and the total of all samples
+	function matches any fully qualified function name containing it, for example "main.fib" or "encoding/json."
+*/
+func (p *Profile) Value(function string) (int64, int64) {
+	p.tb.Helper()
+
+	idx, err := analysis.SampleIndex(p.Profile, p.SampleType)
+	if err != nil {
+		p.tb.Fatalf("profiletest: %s", err)
+		return 0, 0
+	}
+
+	var value, total int64
+	for _, sample := range p.Sample {
+		total += sample.Value[idx]
+		for _, name := range analysis.StackFunctions(sample) {
+			if strings.Contains(name, function) {
+				value += sample.Value[idx]
+				break
+			}
+		}
+	}
+	return value, total
+}
+
+// Share returns the fraction (0 to 1) of the samples with the function in their stack, 0 if the profile is empty
+func (p *Profile) Share(function string) float64 {
+	p.tb.Helper()
+
+	value, total := p.Value(function)
+	if total == 0 {
+		return 0
+	}
+	return float64(value) / float64(total)
+}
+
+// AssertShareAbove fails the test unless the function accounts for more than min (0 to 1) of the samples
+func (p *Profile) AssertShareAbove(function string, min float64) bool {
+	p.tb.Helper()
+
+	share := p.Share(function)
+	if share <= min {
+		p.tb.Errorf("profiletest: %q accounts for %.1f%% of samples, expected more than %.1f%%",
+			function, share*100, min*100)
+		return false
+	}
+	return true
+}
+
+// AssertShareBelow fails the test unless the function accounts for less than max (0 to 1) of the samples
+func (p *Profile) AssertShareBelow(function string, max float64) bool {
+	p.tb.Helper()
+
+	share := p.Share(function)
+	if share >= max {
+		p.tb.Errorf("profiletest: %q accounts for %.1f%% of samples, expected less than %.1f%%",
+			function, share*100, max*100)
+		return false
+	}
+	return true
+}
+
+// AssertNoSamples fails the test if any sample has the function in its stack, for example no allocations in it
+func (p *Profile) AssertNoSamples(function string) bool {
+	p.tb.Helper()
+
+	value, _ := p.Value(function)
+	if value != 0 {
+		p.tb.Errorf("profiletest: %q has samples for a total value of %d, expected none", function, value)
+		return false
+	}
+	return true
+}
+
+/*
+	AssertNoGoroutineLeak runs fn and fails the test unless the number of goroutines returns to the one before fn
+	within DefaultGoroutineLeakTimeout, reporting the stacks of the running goroutines
+*/
+func AssertNoGoroutineLeak(tb testing.TB, fn func()) bool {
+	tb.Helper()
+
+	baseline := runtime.NumGoroutine()
+	fn()
+
+	deadline := time.Now().Add(DefaultGoroutineLeakTimeout)
+	for {
+		count := runtime.NumGoroutine()
+		if count <= baseline {
+			return true
+		}
+		if time.Now().After(deadline) {
+			var stacks bytes.Buffer
+			_ = pprof.Lookup("goroutine").WriteTo(&stacks, 1)
+			tb.Errorf("profiletest: %d goroutines running, expected %d as before\n%s", count, baseline, stacks.String())
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
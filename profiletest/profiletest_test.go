@@ -0,0 +1,89 @@
+package profiletest_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2/profiletest"
+)
+
+var sink []byte
+
+//go:noinline
+func burn(d time.Duration) int {
+	n := 0
+	for start := time.Now(); time.Since(start) < d; {
+		n++
+	}
+	return n
+}
+
+//go:noinline
+func allocate() {
+	for i := 0; i < 1000; i++ {
+		sink = make([]byte, 1024)
+	}
+}
+
+//go:noinline
+func noAllocations() int {
+	n := 0
+	for i := 0; i < 1000; i++ {
+		n += i
+	}
+	return n
+}
+
+// recordingTB records failures instead of failing the test
+type recordingTB struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestRunCPU(t *testing.T) {
+	prof := profiletest.Run(t, profiletest.CPU, func() { burn(300 * time.Millisecond) })
+	prof.AssertShareAbove("profiletest_test.burn", 0.5)
+	prof.AssertNoSamples("profiletest_test.allocate")
+}
+
+func TestRunMem(t *testing.T) {
+	prof := profiletest.Run(t, profiletest.Mem, func() {
+		allocate()
+		noAllocations()
+	})
+	prof.AssertShareAbove("profiletest_test.allocate", 0.5)
+	prof.AssertNoSamples("profiletest_test.noAllocations")
+}
+
+func TestAssertShareFailure(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	recorded := profiletest.Run(tb, profiletest.Mem, allocate)
+	assert.False(t, recorded.AssertShareBelow("profiletest_test.allocate", 0.1))
+	assert.False(t, recorded.AssertNoSamples("profiletest_test.allocate"))
+	assert.Len(t, tb.failures, 2)
+}
+
+func TestAssertNoGoroutineLeak(t *testing.T) {
+	assert.True(t, profiletest.AssertNoGoroutineLeak(t, func() {
+		done := make(chan struct{})
+		go func() { close(done) }()
+		<-done
+	}))
+
+	stop := make(chan struct{})
+	defer close(stop)
+	tb := &recordingTB{TB: t}
+	assert.False(t, profiletest.AssertNoGoroutineLeak(tb, func() {
+		go func() { <-stop }()
+	}))
+	if assert.Len(t, tb.failures, 1) {
+		assert.Contains(t, tb.failures[0], "TestAssertNoGoroutineLeak")
+	}
+}
@@ -0,0 +1,73 @@
+package profile
+
+import (
+	"time"
+)
+
+// Result describes a completed profile flush, whether it succeeded or not
+type Result struct {
+	// Mode holds the short name of the profiling mode (cpu, mem, mutex, etc), as used in EnvModes
+	Mode string
+
+	// Path holds the path to the profile file
+	Path string
+
+	// Location holds where the profile file was delivered to by sinks, blank if not delivered
+	Location string
+
+	// Size holds the size in bytes of the profile file
+	Size int64
+
+	// StartTime holds the time at which the profiling session started
+	StartTime time.Time
+
+	// StopTime holds the time at which the profile was flushed
+	StopTime time.Time
+
+	// Duration holds the duration of the profiling session
+	Duration time.Duration
+
+	// Labels holds the user-supplied labels from Config
+	Labels map[string]string
+
+	// Err holds the first error the profiling session hit, nil if it succeeded
+	Err error
+}
+
+/*
+	Notifier is informed of every completed profile, for example to send a webhook
+	Notifiers are called synchronously, in order, during Stop (and on every flight recorder dump), after sinks
+*/
+type Notifier interface {
+	Notify(result Result) error
+}
+
+// result returns the result of the last flush of the current profiling session
+func (p *Profile) result() Result {
+	return Result{
+		Mode:      modeEnvNames[p.mode],
+		Path:      p.filePath,
+		Location:  p.location,
+		Size:      p.size,
+		StartTime: p.startTime,
+		StopTime:  p.stopTime,
+		Duration:  p.stopTime.Sub(p.startTime),
+		Labels:    p.labels,
+		Err:       p.sessionErr(),
+	}
+}
+
+// notify informs all configured notifiers of the result of the last flush
+func (p *Profile) notify() {
+	if len(p.notifiers) == 0 {
+		return
+	}
+
+	result := p.result()
+	for _, notifier := range p.notifiers {
+		err := notifier.Notify(result)
+		if err != nil {
+			p.logf(LevelError, "%s profiling notification failed: %s", string(p.mode), err.Error())
+		}
+	}
+}
@@ -0,0 +1,241 @@
+/*
+	Package s3sink uploads profile files written by multi-profile to an S3-compatible object store
+	(AWS S3, MinIO, Ceph, etc), so they survive the container or host they were captured on.
+*/
+package s3sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bygui86/multi-profile/v2"
+	"github.com/bygui86/multi-profile/v2/internal/httpretry"
+)
+
+const (
+	// DefaultRegion holds the default region requests are signed for
+	DefaultRegion = "us-east-1"
+
+	/*
+		DefaultLayout holds the default layout of object keys, below Prefix
+		Available placeholders:   {hostname} | {pid} | {mode} | {date} | {time} | {file} | {label:<key>}
+		{date} and {time} refer to the session start, formatted as 2006-01-02 and 150405.000 (milliseconds)
+		The default layout includes {pid}, so sessions of different processes on a host never share a key
+	*/
+	DefaultLayout = "{hostname}/{date}/{mode}/{time}-{pid}-{file}"
+
+	// DefaultMaxRetries holds the default number of retries of a failed upload
+	DefaultMaxRetries = 3
+
+	// DefaultRetryBackoff holds the default pause before uploading a file again, see Config.RetryBackoff
+	DefaultRetryBackoff = 500 * time.Millisecond
+
+	// DefaultTimeout holds the default timeout of a single upload request
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultDeliveryTimeout holds the default time budget of a Send, profile file and manifest together
+	DefaultDeliveryTimeout = 10 * time.Second
+)
+
+// Config holds configurations to create a new Sink
+type Config struct {
+	// Endpoint holds the base URL of the object store, for example "https://s3.eu-west-1.amazonaws.com"
+	Endpoint string
+
+	// Region holds the region requests are signed for, see DefaultRegion for default
+	Region string
+
+	// Bucket holds the bucket objects are uploaded to, addressed in path-style (<endpoint>/<bucket>/<key>)
+	Bucket string
+
+	// Prefix holds the key prefix of all uploaded objects
+	Prefix string
+
+	// Layout holds the layout of object keys below Prefix, see DefaultLayout for default and placeholders
+	Layout string
+
+	/*
+		AccessKeyID, SecretAccessKey and SessionToken hold the credentials to sign requests with
+		If AccessKeyID is blank, requests are sent unsigned
+	*/
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// MaxRetries holds the number of retries of a failed upload, see DefaultMaxRetries for default, negative for none
+	MaxRetries int
+
+	/*
+		RetryBackoff holds the pause before the second attempt of an upload, each further pause lasts twice the
+		previous one, see DefaultRetryBackoff for default
+	*/
+	RetryBackoff time.Duration
+
+	// Timeout holds the timeout of a single upload request, see DefaultTimeout for default
+	Timeout time.Duration
+
+	/*
+		DeliveryTimeout caps a whole Send, uploads of the profile file and manifest and their retries included, see
+		DefaultDeliveryTimeout for default. A profile Stop waits for its sinks, an object store that does not answer
+		delays it by DeliveryTimeout at most
+	*/
+	DeliveryTimeout time.Duration
+
+	// DeleteLocal deletes the local profile file (and manifest) once uploaded
+	DeleteLocal bool
+
+	// HTTPClient holds the client uploads go through, by default one with Timeout
+	HTTPClient *http.Client
+}
+
+// Sink uploads profile files to an S3-compatible object store, it implements profile.Sink
+type Sink struct {
+	endpoint        string
+	region          string
+	bucket          string
+	prefix          string
+	layout          string
+	creds           credentials
+	retry           httpretry.Policy
+	deliveryTimeout time.Duration
+	deleteLocal     bool
+	client          *http.Client
+	hostname        string
+	now             func() time.Time
+}
+
+// New returns a new Sink uploading to the object store described by cfg
+func New(cfg *Config) (*Sink, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("s3 sink endpoint not set")
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 sink bucket not set")
+	}
+
+	sink := &Sink{
+		endpoint:        strings.TrimSuffix(cfg.Endpoint, "/"),
+		region:          cfg.Region,
+		bucket:          cfg.Bucket,
+		prefix:          cfg.Prefix,
+		layout:          cfg.Layout,
+		creds:           credentials{cfg.AccessKeyID, cfg.SecretAccessKey, cfg.SessionToken},
+		retry:           httpretry.NewPolicy(cfg.MaxRetries, cfg.RetryBackoff, DefaultMaxRetries, DefaultRetryBackoff),
+		deliveryTimeout: cfg.DeliveryTimeout,
+		deleteLocal:     cfg.DeleteLocal,
+		client:          cfg.HTTPClient,
+		now:             time.Now,
+	}
+	if sink.region == "" {
+		sink.region = DefaultRegion
+	}
+	if sink.layout == "" {
+		sink.layout = DefaultLayout
+	}
+	if sink.deliveryTimeout <= 0 {
+		sink.deliveryTimeout = DefaultDeliveryTimeout
+	}
+	if sink.client == nil {
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		sink.client = &http.Client{Timeout: timeout}
+	}
+	sink.hostname, _ = os.Hostname()
+
+	return sink, nil
+}
+
+/*
+	Send uploads the profile file and its manifest, if any, returning the URL of the uploaded profile file
+	It gives up when DeliveryTimeout expires
+*/
+func (s *Sink) Send(artifact profile.Artifact) (profile.Delivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.deliveryTimeout)
+	defer cancel()
+
+	files := []string{artifact.Path}
+	if artifact.ManifestPath != "" {
+		files = append(files, artifact.ManifestPath)
+	}
+
+	var delivery profile.Delivery
+	for i, file := range files {
+		location, err := s.upload(ctx, file, s.objectKey(artifact, filepath.Base(file)))
+		if err != nil {
+			return delivery, err
+		}
+		if i == 0 {
+			delivery.Location = location
+		}
+	}
+
+	if s.deleteLocal {
+		for _, file := range files {
+			err := os.Remove(file)
+			if err != nil {
+				return delivery, fmt.Errorf("deleting local file %s failed: %w", file, err)
+			}
+			delivery.DeletedLocal++
+		}
+	}
+	return delivery, nil
+}
+
+// objectKey returns the key of the object the given file of the artifact is uploaded to
+func (s *Sink) objectKey(artifact profile.Artifact, fileName string) string {
+	replacements := []string{
+		"{hostname}", s.hostname,
+		"{pid}", strconv.Itoa(os.Getpid()),
+		"{mode}", artifact.Mode,
+		"{date}", artifact.StartTime.UTC().Format("2006-01-02"),
+		"{time}", artifact.StartTime.UTC().Format("150405.000"),
+		"{file}", fileName,
+	}
+	for key, value := range artifact.Labels {
+		replacements = append(replacements, "{label:"+key+"}", value)
+	}
+	key := strings.NewReplacer(replacements...).Replace(s.layout)
+	return strings.TrimPrefix(path.Join(s.prefix, key), "/")
+}
+
+// upload puts the file to the given key, retrying transient failures until ctx is done, returning the object URL
+func (s *Sink) upload(ctx context.Context, file, key string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	segments := strings.Split(s.bucket+"/"+key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	location := s.endpoint + "/" + strings.Join(segments, "/")
+
+	attempts, err := httpretry.Do(ctx, s.client, s.retry, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, location, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		if s.creds.accessKeyID != "" {
+			signRequest(req, s.creds, s.region, hashHex(data), s.now())
+		}
+		return req, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("uploading file %s to %s failed after %d attempts: %w", file, location, attempts, err)
+	}
+	return location, nil
+}
@@ -0,0 +1,175 @@
+package s3sink_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+	"github.com/bygui86/multi-profile/v2/s3sink"
+)
+
+// fakeStore is a minimal stand-in of an S3-compatible object store, failing the first request
+type fakeStore struct {
+	mu       sync.Mutex
+	requests int
+	objects  map[string][]byte
+	auth     []string
+}
+
+func (f *fakeStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	if f.requests == 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	f.objects[r.Method+" "+r.URL.Path] = body
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+}
+
+func TestSinkUpload(t *testing.T) {
+	store := &fakeStore{objects: map[string][]byte{}}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	sink, err := s3sink.New(&s3sink.Config{
+		Endpoint:        server.URL,
+		Bucket:          "profiles",
+		Prefix:          "prod",
+		Layout:          "{label:service}/{mode}/{file}",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		RetryBackoff:    time.Millisecond,
+		DeleteLocal:     true,
+	})
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	before := profile.ReadSelfMetrics().RetentionDeletions
+	profile.BlockProfile(&profile.Config{
+		Path:     dir,
+		Quiet:    true,
+		Manifest: true,
+		Labels:   map[string]string{"service": "api"},
+		Sinks:    []profile.Sink{sink},
+	}).Start().Stop()
+
+	assert.Equal(t, 3, store.requests)
+	assert.Contains(t, store.objects, "PUT /profiles/prod/api/block/block.pprof")
+	assert.Contains(t, store.objects, "PUT /profiles/prod/api/block/block.manifest.json")
+	for _, auth := range store.auth {
+		assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/"), auth)
+		assert.Contains(t, auth, "/us-east-1/s3/aws4_request")
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "block.pprof"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, before+2, profile.ReadSelfMetrics().RetentionDeletions)
+}
+
+func TestSinkClientError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	sink, err := s3sink.New(&s3sink.Config{Endpoint: server.URL, Bucket: "profiles", RetryBackoff: time.Millisecond})
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "cpu.pprof")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("data"), 0644))
+
+	_, err = sink.Send(profile.Artifact{Mode: "cpu", Path: file})
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests)
+	_, err = os.Stat(file)
+	assert.NoError(t, err)
+}
+
+func TestSinkNoRetries(t *testing.T) {
+	store := &fakeStore{objects: map[string][]byte{}}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	sink, err := s3sink.New(&s3sink.Config{
+		Endpoint: server.URL, Bucket: "profiles", MaxRetries: -1, RetryBackoff: time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "cpu.pprof")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("data"), 0644))
+
+	_, err = sink.Send(profile.Artifact{Mode: "cpu", Path: file})
+	assert.Error(t, err)
+	assert.Equal(t, 1, store.requests)
+}
+
+func TestSinkDeliveryTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink, err := s3sink.New(&s3sink.Config{
+		Endpoint:        server.URL,
+		Bucket:          "profiles",
+		MaxRetries:      10,
+		RetryBackoff:    time.Second,
+		DeliveryTimeout: 100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "cpu.pprof")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("data"), 0644))
+
+	start := time.Now()
+	_, err = sink.Send(profile.Artifact{Mode: "cpu", Path: file})
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < time.Second, time.Since(start).String())
+}
+
+func TestNewMissingBucket(t *testing.T) {
+	_, err := s3sink.New(&s3sink.Config{Endpoint: "http://localhost:9000"})
+	assert.Error(t, err)
+}
+
+func TestSinkDefaultLayout(t *testing.T) {
+	store := &fakeStore{objects: map[string][]byte{}}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	sink, err := s3sink.New(&s3sink.Config{Endpoint: server.URL, Bucket: "profiles", RetryBackoff: time.Millisecond})
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "block.pprof")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("data"), 0644))
+
+	// two sessions started within the same second get different keys
+	start := time.Date(2021, 4, 7, 10, 20, 30, 0, time.UTC)
+	first, err := sink.Send(profile.Artifact{Mode: "block", Path: file, StartTime: start})
+	assert.NoError(t, err)
+	second, err := sink.Send(profile.Artifact{Mode: "block", Path: file, StartTime: start.Add(5 * time.Millisecond)})
+	assert.NoError(t, err)
+
+	hostname, _ := os.Hostname()
+	pid := strconv.Itoa(os.Getpid())
+	firstKey := "/profiles/" + hostname + "/2021-04-07/block/102030.000-" + pid + "-block.pprof"
+	assert.True(t, strings.HasSuffix(first.Location, firstKey), first.Location)
+	assert.True(t, strings.HasSuffix(second.Location, "/102030.005-"+pid+"-block.pprof"), second.Location)
+	assert.Len(t, store.objects, 2)
+}
@@ -0,0 +1,209 @@
+package profile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SelfMetricsContentType holds the content type of the Prometheus text exposition format
+const SelfMetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// ModeSelfMetrics holds the profiler self-metrics of a single profiling mode
+type ModeSelfMetrics struct {
+	// SessionsStarted holds the number of profiling sessions started
+	SessionsStarted uint64
+
+	// SessionsFailed holds the number of profiling sessions that hit at least one error
+	SessionsFailed uint64
+
+	// BytesWritten holds the number of bytes written to profile files
+	BytesWritten uint64
+
+	// FlushCount holds the number of profile flushes
+	FlushCount uint64
+
+	// FlushSeconds holds the total time spent flushing profiles
+	FlushSeconds float64
+
+	// Active holds the number of profiling sessions currently running
+	Active int64
+}
+
+// SelfMetrics holds a snapshot of the profiler self-metrics
+type SelfMetrics struct {
+	// Modes holds the metrics of each profiling mode, keyed by mode name (cpu, mem, mutex, etc)
+	Modes map[string]ModeSelfMetrics
+
+	// RetentionDeletions holds the number of profile files deleted by retention policies
+	RetentionDeletions uint64
+}
+
+// selfMetricsRegistry collects the profiler self-metrics of all profiles in the process
+type selfMetricsRegistry struct {
+	mu                 sync.Mutex
+	modes              map[profileMode]*ModeSelfMetrics
+	retentionDeletions uint64
+}
+
+// selfMetrics holds the process-wide profiler self-metrics registry
+var selfMetrics = &selfMetricsRegistry{modes: map[profileMode]*ModeSelfMetrics{}}
+
+// update runs fn on the metrics of the given mode, holding the registry lock
+func (r *selfMetricsRegistry) update(mode profileMode, fn func(m *ModeSelfMetrics)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.modes[mode]
+	if !ok {
+		m = &ModeSelfMetrics{}
+		r.modes[mode] = m
+	}
+	fn(m)
+}
+
+// sessionStarted records the start of a profiling session
+func (r *selfMetricsRegistry) sessionStarted(mode profileMode) {
+	r.update(mode, func(m *ModeSelfMetrics) {
+		m.SessionsStarted++
+		m.Active++
+	})
+}
+
+// sessionStopped records the stop of a profiling session
+func (r *selfMetricsRegistry) sessionStopped(mode profileMode) {
+	r.update(mode, func(m *ModeSelfMetrics) {
+		m.Active--
+	})
+}
+
+// sessionFailed records a failed profiling session
+func (r *selfMetricsRegistry) sessionFailed(mode profileMode) {
+	r.update(mode, func(m *ModeSelfMetrics) {
+		m.SessionsFailed++
+	})
+}
+
+// flushed records a profile flush, with its duration and the size of the written file
+func (r *selfMetricsRegistry) flushed(mode profileMode, duration time.Duration, bytes int64) {
+	r.update(mode, func(m *ModeSelfMetrics) {
+		m.FlushCount++
+		m.FlushSeconds += duration.Seconds()
+		if bytes > 0 {
+			m.BytesWritten += uint64(bytes)
+		}
+	})
+}
+
+// retentionDeleted records profile files deleted by a retention policy
+func (r *selfMetricsRegistry) retentionDeleted(count int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.retentionDeletions += uint64(count)
+}
+
+// snapshot returns a copy of the current metrics
+func (r *selfMetricsRegistry) snapshot() SelfMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := SelfMetrics{
+		Modes:              make(map[string]ModeSelfMetrics, len(r.modes)),
+		RetentionDeletions: r.retentionDeletions,
+	}
+	for mode, m := range r.modes {
+		snapshot.Modes[modeEnvNames[mode]] = *m
+	}
+	return snapshot
+}
+
+// ReadSelfMetrics returns a snapshot of the profiler self-metrics, collected across all profiles of the process
+func ReadSelfMetrics() SelfMetrics {
+	return selfMetrics.snapshot()
+}
+
+/*
+	WriteSelfMetrics writes the profiler self-metrics to w in the Prometheus text exposition format
+	All metric names are prefixed by "multiprofile_" and labelled by profiling mode
+*/
+func WriteSelfMetrics(w io.Writer) error {
+	snapshot := ReadSelfMetrics()
+
+	modes := make([]string, 0, len(snapshot.Modes))
+	for mode := range snapshot.Modes {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+
+	buf := bufio.NewWriter(w)
+	writeFamily := func(name, help, kind string, value func(m ModeSelfMetrics) string) {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, mode := range modes {
+			fmt.Fprintf(buf, "%s{mode=\"%s\"} %s\n", name, escapeLabelValue(mode), value(snapshot.Modes[mode]))
+		}
+	}
+
+	writeFamily("multiprofile_sessions_started_total", "Number of profiling sessions started.", "counter",
+		func(m ModeSelfMetrics) string { return fmt.Sprint(m.SessionsStarted) })
+	writeFamily("multiprofile_sessions_failed_total", "Number of profiling sessions that failed.", "counter",
+		func(m ModeSelfMetrics) string { return fmt.Sprint(m.SessionsFailed) })
+	writeFamily("multiprofile_bytes_written_total", "Number of bytes written to profile files.", "counter",
+		func(m ModeSelfMetrics) string { return fmt.Sprint(m.BytesWritten) })
+
+	// summary without quantiles, both samples belong to the same family
+	fmt.Fprint(buf, "# HELP multiprofile_flush_duration_seconds Time spent flushing profiles.\n"+
+		"# TYPE multiprofile_flush_duration_seconds summary\n")
+	for _, mode := range modes {
+		m := snapshot.Modes[mode]
+		label := escapeLabelValue(mode)
+		fmt.Fprintf(buf, "multiprofile_flush_duration_seconds_sum{mode=\"%s\"} %v\n", label, m.FlushSeconds)
+		fmt.Fprintf(buf, "multiprofile_flush_duration_seconds_count{mode=\"%s\"} %d\n", label, m.FlushCount)
+	}
+
+	writeFamily("multiprofile_active_profiles", "Number of profiling sessions currently running.", "gauge",
+		func(m ModeSelfMetrics) string { return fmt.Sprint(m.Active) })
+
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s counter\n%s %d\n",
+		"multiprofile_retention_deletions_total", "Number of profile files deleted by retention policies.",
+		"multiprofile_retention_deletions_total", "multiprofile_retention_deletions_total", snapshot.RetentionDeletions)
+
+	return buf.Flush()
+}
+
+// SelfMetricsHandler returns an HTTP handler serving the profiler self-metrics in the Prometheus text exposition format
+func SelfMetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", SelfMetricsContentType)
+		_ = WriteSelfMetrics(w)
+	})
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line feeds as required by the Prometheus text format
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+/*
+	recordFlush records a profile flush that took the given duration, measuring the size of the written file
+	It must run after the last rewrite of the file, so size, metrics and notifications report the final file
+*/
+func (p *Profile) recordFlush(duration time.Duration) {
+	var size int64
+	if p.filePath != "" {
+		info, err := os.Stat(p.filePath)
+		if err == nil {
+			size = info.Size()
+		}
+	}
+	p.size = size
+	selfMetrics.flushed(p.mode, duration, size)
+	p.logw(LevelDebug, fmt.Sprintf("%s profiling flushed", string(p.mode)),
+		Field{Key: "path", Value: p.filePath}, Field{Key: "bytes", Value: size}, Field{Key: "duration", Value: duration})
+}
@@ -0,0 +1,44 @@
+package profile_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+)
+
+func TestSelfMetrics(t *testing.T) {
+	before := profile.ReadSelfMetrics().Modes["block"]
+
+	prof := profile.BlockProfile(&profile.Config{Path: t.TempDir(), Quiet: true}).Start()
+	assert.Equal(t, before.Active+1, profile.ReadSelfMetrics().Modes["block"].Active)
+	prof.Stop()
+
+	after := profile.ReadSelfMetrics().Modes["block"]
+	assert.Equal(t, before.SessionsStarted+1, after.SessionsStarted)
+	assert.Equal(t, before.SessionsFailed, after.SessionsFailed)
+	assert.Equal(t, before.FlushCount+1, after.FlushCount)
+	assert.True(t, after.BytesWritten > before.BytesWritten)
+	assert.Equal(t, before.Active, after.Active)
+}
+
+func TestSelfMetricsHandler(t *testing.T) {
+	profile.BlockProfile(&profile.Config{Path: t.TempDir(), Quiet: true}).Start().Stop()
+
+	recorder := httptest.NewRecorder()
+	profile.SelfMetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, profile.SelfMetricsContentType, recorder.Header().Get("Content-Type"))
+	body, err := ioutil.ReadAll(recorder.Body)
+	checkErr(t, err)
+	assert.Contains(t, string(body), "# TYPE multiprofile_sessions_started_total counter")
+	assert.Contains(t, string(body), "# TYPE multiprofile_flush_duration_seconds summary\n"+
+		"multiprofile_flush_duration_seconds_sum{mode=")
+	assert.NotContains(t, string(body), "# TYPE multiprofile_flush_duration_seconds_sum")
+	assert.Contains(t, string(body), `multiprofile_sessions_started_total{mode="block"}`)
+	assert.Contains(t, string(body), `multiprofile_active_profiles{mode="block"} 0`)
+	assert.Contains(t, string(body), "multiprofile_retention_deletions_total 0")
+}
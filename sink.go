@@ -0,0 +1,87 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Artifact describes the files written by a successful profile flush
+type Artifact struct {
+	// Mode holds the short name of the profiling mode (cpu, mem, mutex, etc), as used in EnvModes
+	Mode string
+
+	// Path holds the path to the profile file
+	Path string
+
+	// ManifestPath holds the path to the manifest file, blank if no manifest was written
+	ManifestPath string
+
+	// Labels holds the user-supplied labels from Config
+	Labels map[string]string
+
+	// StartTime holds the time at which the profiling session started
+	StartTime time.Time
+
+	// StopTime holds the time at which the profile was flushed
+	StopTime time.Time
+}
+
+// Delivery describes the outcome of a successful Sink.Send
+type Delivery struct {
+	// Location holds where the profile file was delivered to, for example its URL
+	Location string
+
+	// DeletedLocal holds the number of local files of the artifact deleted by the sink after delivering them
+	DeletedLocal int
+}
+
+/*
+	Sink receives the artifacts of every successful profile flush, for example to upload them to a remote store
+	Sinks are called synchronously, in order, during Stop (and on every flight recorder dump)
+	A sink deleting the local files should be the last one
+*/
+type Sink interface {
+	Send(artifact Artifact) (Delivery, error)
+}
+
+// artifact returns the artifact describing the last flush of the current profiling session
+func (p *Profile) artifact() Artifact {
+	artifact := Artifact{
+		Mode:      modeEnvNames[p.mode],
+		Path:      p.filePath,
+		Labels:    p.labels,
+		StartTime: p.startTime,
+		StopTime:  p.stopTime,
+	}
+	if p.manifest {
+		manifestPath := filepath.Join(p.path, manifestFileName(p.fileName))
+		if _, err := os.Stat(manifestPath); err == nil {
+			artifact.ManifestPath = manifestPath
+		}
+	}
+	return artifact
+}
+
+// sendToSinks sends the artifact of the last flush to all configured sinks, unless the session failed
+func (p *Profile) sendToSinks() {
+	if len(p.sinks) == 0 || p.sessionErr() != nil {
+		return
+	}
+
+	artifact := p.artifact()
+	for _, sink := range p.sinks {
+		delivery, err := sink.Send(artifact)
+		if err != nil {
+			p.failf("%s profiling sending file %s to sink failed: %s", string(p.mode), artifact.Path, err.Error())
+			continue
+		}
+		if delivery.Location != "" {
+			p.location = delivery.Location
+		}
+		if delivery.DeletedLocal > 0 {
+			selfMetrics.retentionDeleted(delivery.DeletedLocal)
+		}
+		p.logf(LevelInfo, "%s profiling file %s sent to %s", string(p.mode), artifact.Path, delivery.Location)
+	}
+}
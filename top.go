@@ -0,0 +1,21 @@
+package profile
+
+import (
+	"github.com/bygui86/multi-profile/v2/analysis"
+)
+
+// logTop logs the top-N functions summary of the profile file
+func (p *Profile) logTop() {
+	if !p.writesPprof() {
+		p.logf(LevelWarn, "%s profiling does not support top summary, skipping", string(p.mode))
+		return
+	}
+
+	report, err := analysis.TopFile(p.filePath, analysis.TopOptions{SampleType: p.topSampleType, N: p.topN})
+	if err != nil {
+		p.logf(LevelError, "%s profiling top summary failed: %s", string(p.mode), err.Error())
+		return
+	}
+
+	p.logf(LevelInfo, "%s profiling top summary of file %s\n%s", string(p.mode), p.filePath, report.String())
+}
@@ -0,0 +1,200 @@
+/*
+	Package webhook notifies HTTP endpoints when a profile written by multi-profile completes, POSTing a JSON Payload
+	to each configured URL.
+*/
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bygui86/multi-profile/v2"
+	"github.com/bygui86/multi-profile/v2/internal/httpretry"
+)
+
+const (
+	// DefaultTimeout holds the default timeout of a single notification request
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultMaxRetries holds the default number of retries of a failed notification
+	DefaultMaxRetries = 3
+
+	// DefaultRetryBackoff holds the default delay after the first failed notification of a URL
+	DefaultRetryBackoff = 500 * time.Millisecond
+
+	// DefaultNotifyTimeout holds the default deadline of a Notify
+	DefaultNotifyTimeout = 10 * time.Second
+)
+
+// Payload holds the JSON body POSTed to webhook URLs
+type Payload struct {
+	// Mode holds the short name of the profiling mode (cpu, mem, mutex, etc)
+	Mode string `json:"mode"`
+
+	// File holds the path to the profile file
+	File string `json:"file,omitempty"`
+
+	// Location holds where the profile file was uploaded to, if any
+	Location string `json:"location,omitempty"`
+
+	// SizeBytes holds the size of the profile file
+	SizeBytes int64 `json:"sizeBytes"`
+
+	// StartTime holds the time at which the profiling session started
+	StartTime time.Time `json:"startTime"`
+
+	// StopTime holds the time at which the profile was flushed
+	StopTime time.Time `json:"stopTime"`
+
+	// DurationSeconds holds the duration of the profiling session
+	DurationSeconds float64 `json:"durationSeconds"`
+
+	// Labels holds the user-supplied labels from Config
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Error holds the error the profiling session hit, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Config holds configurations to create a new Notifier
+type Config struct {
+	// URLs holds the endpoints notified of every completed profile
+	URLs []string
+
+	// Headers holds additional headers of every notification request, for example authentication
+	Headers map[string]string
+
+	// Timeout holds the timeout of a single notification request, see DefaultTimeout for default
+	Timeout time.Duration
+
+	// MaxRetries holds how many times a failed notification is retried, see DefaultMaxRetries for default, -1 for never
+	MaxRetries int
+
+	// RetryBackoff holds the delay after the first failed notification, later delays grow exponentially
+	RetryBackoff time.Duration
+
+	/*
+		NotifyTimeout holds the deadline shared by all URLs of a Notify, retries included, see DefaultNotifyTimeout for
+		default. The profiled application waits for notifiers when stopping a profile, keep it short
+	*/
+	NotifyTimeout time.Duration
+
+	// HTTPClient holds the client notifications are POSTed with, when nil one is created with Timeout
+	HTTPClient *http.Client
+}
+
+// Notifier POSTs a JSON payload to webhook URLs, it implements profile.Notifier
+type Notifier struct {
+	urls          []string
+	headers       map[string]string
+	retry         httpretry.Policy
+	notifyTimeout time.Duration
+	client        *http.Client
+}
+
+// New returns a new Notifier POSTing to the URLs of cfg
+func New(cfg *Config) (*Notifier, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("webhook notifier URLs not set")
+	}
+
+	notifier := &Notifier{
+		urls:          cfg.URLs,
+		headers:       cfg.Headers,
+		retry:         httpretry.NewPolicy(cfg.MaxRetries, cfg.RetryBackoff, DefaultMaxRetries, DefaultRetryBackoff),
+		notifyTimeout: cfg.NotifyTimeout,
+		client:        cfg.HTTPClient,
+	}
+	if notifier.notifyTimeout <= 0 {
+		notifier.notifyTimeout = DefaultNotifyTimeout
+	}
+	if notifier.client == nil {
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		notifier.client = &http.Client{Timeout: timeout}
+	}
+
+	return notifier, nil
+}
+
+// NewPayload returns the payload describing the given result
+func NewPayload(result profile.Result) Payload {
+	payload := Payload{
+		Mode:            result.Mode,
+		File:            result.Path,
+		Location:        result.Location,
+		SizeBytes:       result.Size,
+		StartTime:       result.StartTime,
+		StopTime:        result.StopTime,
+		DurationSeconds: result.Duration.Seconds(),
+		Labels:          result.Labels,
+	}
+	if result.Err != nil {
+		payload.Error = result.Err.Error()
+	}
+	return payload
+}
+
+/*
+	Notify POSTs the payload of the result to every URL concurrently, returning the errors of the URLs that could not
+	be notified. It gives up when NotifyTimeout expires
+*/
+func (n *Notifier) Notify(result profile.Result) error {
+	body, err := json.Marshal(NewPayload(result))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.notifyTimeout)
+	defer cancel()
+
+	errs := make([]error, len(n.urls))
+	var wg sync.WaitGroup
+	for i, url := range n.urls {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			errs[i] = n.postWithRetry(ctx, url, body)
+		}(i, url)
+	}
+	wg.Wait()
+
+	var failures []string
+	for _, err := range errs {
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// postWithRetry POSTs the body to the URL, retrying transient failures until ctx is done
+func (n *Notifier) postWithRetry(ctx context.Context, url string, body []byte) error {
+	attempts, err := httpretry.Do(ctx, n.client, n.retry, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for key, value := range n.headers {
+			req.Header.Set(key, value)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("notifying %s failed after %d attempts: %w", url, attempts, err)
+	}
+	return nil
+}
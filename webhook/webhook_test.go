@@ -0,0 +1,110 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bygui86/multi-profile/v2"
+	"github.com/bygui86/multi-profile/v2/webhook"
+)
+
+func TestNotify(t *testing.T) {
+	var mu sync.Mutex
+	var payloads []webhook.Payload
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		var payload webhook.Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	notifier, err := webhook.New(&webhook.Config{
+		URLs:         []string{server.URL},
+		Headers:      map[string]string{"X-Token": "secret"},
+		RetryBackoff: time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	profile.BlockProfile(&profile.Config{
+		Path:      dir,
+		Quiet:     true,
+		Labels:    map[string]string{"service": "api"},
+		Notifiers: []profile.Notifier{notifier},
+	}).Start().Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, payloads, 1) {
+		assert.Equal(t, "block", payloads[0].Mode)
+		assert.Equal(t, filepath.Join(dir, "block.pprof"), payloads[0].File)
+		assert.True(t, payloads[0].SizeBytes > 0)
+		assert.True(t, payloads[0].DurationSeconds >= 0)
+		assert.Equal(t, map[string]string{"service": "api"}, payloads[0].Labels)
+		assert.Empty(t, payloads[0].Error)
+	}
+}
+
+func TestNotifyClientError(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	notifier, err := webhook.New(&webhook.Config{URLs: []string{server.URL}, RetryBackoff: time.Millisecond})
+	assert.NoError(t, err)
+
+	err = notifier.Notify(profile.Result{Mode: "cpu"})
+	assert.Error(t, err)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, attempts)
+}
+
+func TestNotifyTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	notifier, err := webhook.New(&webhook.Config{
+		URLs:          []string{server.URL, server.URL + "/other"},
+		RetryBackoff:  time.Millisecond,
+		NotifyTimeout: 200 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	start := time.Now()
+	err = notifier.Notify(profile.Result{Mode: "cpu"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), server.URL+"/other")
+	// URLs are notified concurrently under one deadline, not one deadline each
+	assert.True(t, time.Since(start) < 2*time.Second)
+}